@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"fmt"
+
 	"github.com/blueWeekend/go-binlog/v1"
 )
 
@@ -23,6 +25,6 @@ func main() {
 	}()
 	// lister.GetBinLogData(b, nil, 0)
 	fmt.Println("start", err == nil)
-	err = lister.Run()
+	err = lister.Run(context.Background())
 	fmt.Println("reslllllll", err == nil, err)
 }
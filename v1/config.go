@@ -1,11 +1,155 @@
 package binlog
 
+import (
+	"reflect"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
 type Config struct {
 	Addr     string
 	User     string
 	Password string
+	// Flavor is mysql or mariadb, defaults to mysql.
+	Flavor string
 
+	// ColumnTag names the struct tag holding the column name, defaults to db.
+	// `db:"-"` skips a field and `db:"name,optional"` leaves it at its zero
+	// value when the table has no such column. Embedded structs are flattened
+	// and `db:"prefix_,inline"` maps a nested struct onto the columns named
+	// prefix_ followed by its own tags.
 	ColumnTag string
+	// Lenient treats every field as optional and skips fields without a tag,
+	// otherwise decoding fails with a *MappingError.
+	Lenient bool
+	// Location is used to parse DATETIME and DATE columns and to convert
+	// TIMESTAMP columns, defaults to time.UTC. Zero dates like 0000-00-00 are
+	// decoded as the zero time.Time, nil for *time.Time and an invalid
+	// sql.NullTime.
+	Location *time.Location
+	// UseDecimal makes canal deliver DECIMAL columns as decimal.Decimal instead
+	// of string. Either way they can be decoded into string, float64, big.Rat,
+	// big.Float or any type implementing encoding.TextUnmarshaler.
+	UseDecimal bool
+	// Decoders decode columns into the given field types, they are consulted
+	// before BinlogScanner and the built-in kinds.
+	Decoders map[reflect.Type]DecodeFunc
+
+	// IncludeTableRegex adds db\.table regular expressions to the tables of the
+	// registered handlers, only these tables are fetched and decoded by canal.
+	IncludeTableRegex []string
+	// ExcludeTableRegex removes tables even if a handler subscribed to them.
+	ExcludeTableRegex []string
+
+	PosHandler PositionHandler
+	// UseGTID starts Latest and ResumeOrLatest without a stored position from
+	// the master's executed GTID set, so that the GTID set can be persisted
+	// from then on.
+	UseGTID bool
+	// StartMode decides where Run starts streaming, ResumeOrLatest by default.
+	StartMode StartMode
+	// StartPosition is the position used by AtPosition.
+	StartPosition mysql.Position
+	// StartGTID is the executed GTID set used by AtGTID, in the format of
+	// Flavor.
+	StartGTID string
+	// StartTime is the time used by AtTimestamp. AtTimestamp has to be set
+	// explicitly, since it starts at StartTime on every Run instead of
+	// resuming.
+	StartTime time.Time
+
+	// AtLeastOnce treats handler panics like errors, which are handled by
+	// FailurePolicy. Without it a panic is only reported and the position
+	// moves on. Together with StopOnFailure or RetryOnFailure the position is
+	// never persisted past a transaction whose rows failed or panicked, a
+	// restart delivers it again. It can not be combined with SkipOnFailure.
+	AtLeastOnce bool
+	// FailurePolicy decides how Run reacts to a handler which returned an
+	// error or could not decode its rows. Retries start after RetryInterval,
+	// one second by default, and back off up to RetryMaxInterval, one minute
+	// by default.
+	FailurePolicy    FailurePolicy
+	RetryInterval    time.Duration
+	RetryMaxInterval time.Duration
+
+	// Workers runs event and row handlers on that many goroutines instead of
+	// the replication goroutine. Rows are hashed by table and primary key, so
+	// changes to the same row keep their order and rows of tables without a
+	// primary key are ordered by table. An update which changes the primary
+	// key to one of another worker waits until both workers are idle. The
+	// position is only persisted once every earlier row has been handled.
+	Workers int
+	// QueueSize bounds the rows events waiting for each worker, 64 by
+	// default. Setting QueueSize or SpillWhenFull without Workers runs the
+	// handlers on one worker.
+	QueueSize int
+	// QueuePolicy decides what happens to rows events for a full queue.
+	QueuePolicy QueuePolicy
+	// SpillDir is the Badger directory used by SpillWhenFull, defaults to
+	// ./binlog_spill. Its content is dropped on Run.
+	SpillDir string
+
+	// Spool durably stores every rows event of the included tables before
+	// the handlers run, tables without a handler can be included with
+	// IncludeTableRegex. The lister does not close it.
+	Spool *Spool
 
-	PosHandler      PositionHandler
+	// ErrorHandler receives every error reported by the lister instead of the
+	// Errors channel. It is called synchronously from the goroutine which
+	// hit the error, so it should not block. With Workers that includes every
+	// worker, so it must be safe for concurrent use.
+	ErrorHandler func(error)
+	// ErrorBufferSize is the capacity of the Errors channel, 64 by default.
+	// Errors which do not fit are dropped and counted by DroppedErrors.
+	ErrorBufferSize int
 }
+
+type FailurePolicy int
+
+const (
+	// StopOnFailure stops Run with the handler error.
+	StopOnFailure FailurePolicy = iota
+	// RetryOnFailure calls the failed handler again with the same rows until it
+	// succeeds or Run is stopped.
+	RetryOnFailure
+	// SkipOnFailure reports the error and moves on, the rows are lost for the
+	// failed handler.
+	SkipOnFailure
+)
+
+type StartMode int
+
+const (
+	// ResumeOrLatest resumes from the stored GTID set or position and starts
+	// like Latest when none has been stored yet.
+	ResumeOrLatest StartMode = iota
+	// Resume is the strict variant of ResumeOrLatest, Run fails with
+	// ErrNoPosition when no position has been stored and with
+	// ErrPositionPurged when the server no longer has its binlog.
+	Resume
+	// Latest starts at the master's current position.
+	Latest
+	// Earliest starts at the oldest binlog the server retained.
+	Earliest
+	// AtPosition starts at StartPosition, Run fails with ErrPositionPurged
+	// when the server no longer has its binlog.
+	AtPosition
+	// AtGTID starts after the transactions of StartGTID, Run fails with
+	// ErrPositionPurged when the server purged transactions missing in it.
+	AtGTID
+	// AtTimestamp starts at the first transaction with an event at or after
+	// StartTime, for example to reprocess the binlog after an incident. The
+	// binlog files are searched by the timestamps of their events.
+	AtTimestamp
+)
+
+type QueuePolicy int
+
+const (
+	// BlockWhenFull blocks the replication reader until the worker caught up.
+	BlockWhenFull QueuePolicy = iota
+	// SpillWhenFull writes rows events for a full queue to SpillDir and keeps
+	// reading, the worker reads them back in order.
+	SpillWhenFull
+)
@@ -1,13 +1,19 @@
 package binlog
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-mysql-org/go-mysql/canal"
 	"github.com/go-mysql-org/go-mysql/mysql"
 	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
 )
 
 type EventHandler interface {
@@ -19,19 +25,141 @@ type EventHandler interface {
 	Schema() any
 }
 
+// TableHandler is an EventHandler whose callbacks also receive the table the
+// rows belong to, which is needed when DbName or TableName is a pattern.
+type TableHandler interface {
+	DbName() string
+	TableName() string
+	OnUpdate(table *schema.Table, datas ...UpdateHandler)
+	OnDelete(table *schema.Table, datas ...any)
+	OnInsert(table *schema.Table, datas ...any)
+	Schema() any
+}
+
+// ErrorEventHandler is a TableHandler whose callbacks report failures, which
+// are handled according to Config.FailurePolicy.
+type ErrorEventHandler interface {
+	DbName() string
+	TableName() string
+	OnUpdate(table *schema.Table, datas ...UpdateHandler) error
+	OnDelete(table *schema.Table, datas ...any) error
+	OnInsert(table *schema.Table, datas ...any) error
+	Schema() any
+}
+
+type eventHandlerAdapter struct {
+	EventHandler
+}
+
+func (h eventHandlerAdapter) OnUpdate(_ *schema.Table, datas ...UpdateHandler) error {
+	h.EventHandler.OnUpdate(datas...)
+	return nil
+}
+
+func (h eventHandlerAdapter) OnDelete(_ *schema.Table, datas ...any) error {
+	h.EventHandler.OnDelete(datas...)
+	return nil
+}
+
+func (h eventHandlerAdapter) OnInsert(_ *schema.Table, datas ...any) error {
+	h.EventHandler.OnInsert(datas...)
+	return nil
+}
+
+type tableHandlerAdapter struct {
+	TableHandler
+}
+
+func (h tableHandlerAdapter) OnUpdate(table *schema.Table, datas ...UpdateHandler) error {
+	h.TableHandler.OnUpdate(table, datas...)
+	return nil
+}
+
+func (h tableHandlerAdapter) OnDelete(table *schema.Table, datas ...any) error {
+	h.TableHandler.OnDelete(table, datas...)
+	return nil
+}
+
+func (h tableHandlerAdapter) OnInsert(table *schema.Table, datas ...any) error {
+	h.TableHandler.OnInsert(table, datas...)
+	return nil
+}
+
 type BinlogHandler struct {
 	canal.DummyEventHandler
 	BinlogParser
-	eventMap map[string]EventHandler
-	config   *Config
-	canalCli *canal.Canal
-	errors   chan error
-	running  bool
+	eventHandlers []*eventSubscription
+	rowHandlers   []*rowSubscription
+	txHandlers    []*txSubscription
+	tx            txBuffer
+	dispatcher    *dispatcher
+	handlerCache  map[string]*tableHandlers
+	config        *Config
+	canalCfg      *canal.Config
+	canalCli      *canal.Canal
+	errors        *errorSink
+
+	mu      sync.Mutex
+	running bool
+	closed  bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+var (
+	ErrClosed = errors.New("binlog lister is already running or closed")
+	// ErrNoPosition is returned by Run with Resume when no position has been
+	// stored yet.
+	ErrNoPosition = errors.New("no binlog position has been stored")
+	// ErrPositionPurged is returned by Run when the server no longer has the
+	// binlog of the start position.
+	ErrPositionPurged = errors.New("binlog position has been purged")
+)
+
+// HandlerError is reported when a handler failed to process the rows of Table,
+// Position is the end of the rows event.
+type HandlerError struct {
+	Table    string
+	Action   string
+	Position mysql.Position
+	Err      error
+}
+
+func (e *HandlerError) Error() string {
+	return fmt.Sprintf("handle %s on %s at %s: %v", e.Action, e.Table, e.Position, e.Err)
+}
+
+func (e *HandlerError) Unwrap() error {
+	return e.Err
+}
+
+type eventSubscription struct {
+	*tableMatcher
+	handler ErrorEventHandler
+}
+
+type rowSubscription struct {
+	*tableMatcher
+	handler RowHandler
 }
 
+// tableHandlers are the handlers subscribed to one table, transactional is
+// set when a TransactionHandler subscribed to it.
+type tableHandlers struct {
+	events        []ErrorEventHandler
+	rows          []RowHandler
+	transactional bool
+}
+
+// rowsEvent is a canal.RowsEvent with its end position, which is taken when
+// canal delivers it since the synced file name changes with every rotate, and
+// the GTID of its transaction.
 type rowsEvent struct {
 	*canal.RowsEvent
 	tableKey string
+	position mysql.Position
+	gtid     string
 }
 
 type UpdateHandler struct {
@@ -39,24 +167,149 @@ type UpdateHandler struct {
 	To   any
 }
 
+// OnRow hands the rows to every handler of the table. Each handler decodes
+// into its own schema and a failing handler does not keep the others from
+// receiving the rows, the first error is returned once all of them ran.
+// With Config.Workers the handlers run on the worker pool instead. The rows
+// are appended to Config.Spool first.
 func (b *BinlogHandler) OnRow(e *canal.RowsEvent) error {
+	event := &rowsEvent{
+		RowsEvent: e,
+		tableKey:  e.Table.Schema + "." + e.Table.Name,
+		gtid:      b.tx.gtid,
+	}
+	event.position = b.eventPosition(event)
+	if b.config.Spool != nil {
+		if err := b.config.Spool.append(event); err != nil {
+			err = fmt.Errorf("spool rows of %s: %w", event.tableKey, err)
+			b.handlerError(err)
+			return err
+		}
+	}
+	handlers := b.handlersOf(event.tableKey)
+	if handlers.transactional {
+		b.bufferTransaction(event)
+	}
+	if len(handlers.events) == 0 && len(handlers.rows) == 0 {
+		return nil
+	}
+	if b.dispatcher != nil {
+		return b.dispatcher.dispatch(event, handlers)
+	}
+	return b.handleRows(event, handlers)
+}
+
+func (b *BinlogHandler) handleRows(event *rowsEvent, handlers *tableHandlers) error {
 	var err error
+	for _, hander := range handlers.events {
+		hander := hander
+		dispatchErr := b.safeDispatch(event.tableKey, event.Action, event.position, func() error {
+			return b.dispatchEvent(hander, event)
+		})
+		if dispatchErr != nil && err == nil {
+			err = dispatchErr
+		}
+	}
+	for _, hander := range handlers.rows {
+		hander := hander
+		dispatchErr := b.safeDispatch(event.tableKey, event.Action, event.position, func() error {
+			return b.dispatchRows(hander, event)
+		})
+		if dispatchErr != nil && err == nil {
+			err = dispatchErr
+		}
+	}
+	return err
+}
+
+// safeDispatch reports the error or panic of one handler as a *HandlerError
+// and applies Config.FailurePolicy, panics are only treated as failures with
+// Config.AtLeastOnce. canal only syncs the position at the end of a
+// transaction after OnRow returned, so a transaction whose error stops Run is
+// never persisted.
+func (b *BinlogHandler) safeDispatch(table string, action string, position mysql.Position, dispatch func() error) error {
+	interval := b.config.RetryInterval
+	for {
+		panicked, err := b.tryDispatch(dispatch)
+		if err == nil {
+			return nil
+		}
+		err = &HandlerError{
+			Table:    table,
+			Action:   action,
+			Position: position,
+			Err:      err,
+		}
+		b.handlerError(err)
+		if panicked && !b.config.AtLeastOnce {
+			return nil
+		}
+		switch b.config.FailurePolicy {
+		case SkipOnFailure:
+			return nil
+		case RetryOnFailure:
+			select {
+			case <-b.ctx.Done():
+				return err
+			case <-time.After(interval):
+			}
+			interval *= 2
+			if interval > b.config.RetryMaxInterval {
+				interval = b.config.RetryMaxInterval
+			}
+		default:
+			return err
+		}
+	}
+}
+
+func (b *BinlogHandler) eventPosition(e *rowsEvent) mysql.Position {
+	var pos mysql.Position
+	if e.Header != nil {
+		pos.Pos = e.Header.LogPos
+	}
+	if b.canalCli != nil {
+		pos.Name = b.canalCli.SyncedPosition().Name
+	}
+	return pos
+}
+
+func (b *BinlogHandler) tryDispatch(dispatch func() error) (panicked bool, err error) {
 	defer func() {
 		if panic := recover(); panic != nil {
-			b.handlerError(errors.New("panic: " + fmt.Sprint(panic)))
-		}
-		if err != nil {
-			b.handlerError(err)
+			err = errors.New("panic: " + fmt.Sprint(panic))
+			panicked = true
 		}
 	}()
-	event := &rowsEvent{
-		RowsEvent: e,
-		tableKey:  e.Table.Schema + "." + e.Table.Name,
+	return false, dispatch()
+}
+
+// handlersOf resolves the handlers of a db.table key once.
+func (b *BinlogHandler) handlersOf(key string) *tableHandlers {
+	if handlers, ok := b.handlerCache[key]; ok {
+		return handlers
 	}
-	hander, ok := b.eventMap[event.tableKey]
-	if !ok {
-		return nil
+	handlers := &tableHandlers{}
+	for _, s := range b.eventHandlers {
+		if s.match(key) {
+			handlers.events = append(handlers.events, s.handler)
+		}
+	}
+	for _, s := range b.rowHandlers {
+		if s.match(key) {
+			handlers.rows = append(handlers.rows, s.handler)
+		}
+	}
+	for _, s := range b.txHandlers {
+		if s.match(key) {
+			handlers.transactional = true
+		}
 	}
+	b.handlerCache[key] = handlers
+	return handlers
+}
+
+func (b *BinlogHandler) dispatchEvent(hander ErrorEventHandler, e *rowsEvent) error {
 	var n = 0
 	var step = 1
 	var inserts, deletes []any
@@ -70,14 +323,14 @@ func (b *BinlogHandler) OnRow(e *canal.RowsEvent) error {
 	}
 	for i := n; i < len(e.Rows); i += step {
 		data := hander.Schema()
-		err = b.GetBinLogData(data, event, i)
+		err := b.GetBinLogData(data, e, i)
 		if err != nil {
 			return err
 		}
 		switch e.Action {
 		case canal.UpdateAction:
 			oldData := hander.Schema()
-			err = b.GetBinLogData(oldData, event, i-1)
+			err = b.GetBinLogData(oldData, e, i-1)
 			if err != nil {
 				return err
 			}
@@ -90,21 +343,17 @@ func (b *BinlogHandler) OnRow(e *canal.RowsEvent) error {
 		case canal.DeleteAction:
 			deletes = append(deletes, data)
 		default:
-			err = errors.New("unknown action of onRow")
-			return err
+			return errors.New("unknown action of onRow")
 		}
 	}
 	if len(updateHandlers) > 0 {
-		hander.OnUpdate(updateHandlers...)
-		return nil
+		return hander.OnUpdate(e.Table, updateHandlers...)
 	}
 	if len(inserts) > 0 {
-		hander.OnInsert(inserts...)
-		return nil
+		return hander.OnInsert(e.Table, inserts...)
 	}
 	if len(deletes) > 0 {
-		hander.OnDelete(deletes...)
-		return nil
+		return hander.OnDelete(e.Table, deletes...)
 	}
 	return nil
 }
@@ -113,19 +362,66 @@ func (h *BinlogHandler) String() string {
 	return "BinlogHandler"
 }
 
+// NewBinlogLister prepares the lister, the connection to MySQL is made by Run
+// so that canal only fetches the tables of the registered handlers.
 func NewBinlogLister(config *Config) (*BinlogHandler, error) {
 	cfg := canal.NewDefaultConfig()
 	cfg.Addr = config.Addr
 	cfg.User = config.User
 	cfg.Password = config.Password
+	if config.Flavor != "" {
+		cfg.Flavor = config.Flavor
+	}
 	cfg.Dump.ExecutionPath = ""
-	c, err := canal.NewCanal(cfg)
-	if err != nil {
-		return nil, err
+	if config.Location == nil {
+		config.Location = time.UTC
+	}
+	cfg.TimestampStringLocation = config.Location
+	cfg.UseDecimal = config.UseDecimal
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = time.Second
+	}
+	if config.RetryMaxInterval <= 0 {
+		config.RetryMaxInterval = time.Minute
+	}
+	if config.RetryMaxInterval < config.RetryInterval {
+		config.RetryMaxInterval = config.RetryInterval
+	}
+	if config.Workers <= 0 && (config.QueueSize > 0 || config.QueuePolicy == SpillWhenFull) {
+		config.Workers = 1
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 64
+	}
+	if config.SpillDir == "" {
+		config.SpillDir = "./binlog_spill"
+	}
+	if config.ErrorBufferSize <= 0 {
+		config.ErrorBufferSize = 64
 	}
 	if config.ColumnTag == "" {
 		config.ColumnTag = "db"
 	}
+	if config.StartMode != AtTimestamp && !config.StartTime.IsZero() {
+		return nil, errors.New("StartTime requires StartMode AtTimestamp")
+	}
+	if config.AtLeastOnce && config.FailurePolicy == SkipOnFailure {
+		return nil, errors.New("AtLeastOnce can not be combined with SkipOnFailure")
+	}
+	switch config.StartMode {
+	case AtPosition:
+		if config.StartPosition.Name == "" {
+			return nil, errors.New("AtPosition requires StartPosition")
+		}
+	case AtGTID:
+		if _, err := mysql.ParseGTIDSet(cfg.Flavor, config.StartGTID); err != nil {
+			return nil, fmt.Errorf("invalid StartGTID: %w", err)
+		}
+	case AtTimestamp:
+		if config.StartTime.IsZero() {
+			return nil, errors.New("AtTimestamp requires StartTime")
+		}
+	}
 	if config.PosHandler == nil {
 		posHandler, err := NewDefaultPosHandler("./binlog_position")
 		if err != nil {
@@ -137,38 +433,120 @@ func NewBinlogLister(config *Config) (*BinlogHandler, error) {
 	lister := &BinlogHandler{
 		BinlogParser: BinlogParser{
 			columnTag: config.ColumnTag,
+			location:  config.Location,
+			decoders:  config.Decoders,
+			lenient:   config.Lenient,
 			onceMap:   make(map[string]*tableSchema, 16),
 		},
-		canalCli: c,
-		errors:   make(chan error, 1),
-		config:   config,
-		eventMap: make(map[string]EventHandler, 16),
+		canalCfg:     cfg,
+		errors:       newErrorSink(config.ErrorHandler, config.ErrorBufferSize),
+		config:       config,
+		handlerCache: make(map[string]*tableHandlers, 16),
 	}
-	lister.canalCli.SetEventHandler(lister)
 	return lister, nil
 }
 
-func (b *BinlogHandler) OnPosSynced(header *replication.EventHeader, pos mysql.Position, _ mysql.GTIDSet, _ bool) error {
-	err := b.config.PosHandler.UpdatePos(pos)
+// newCanal limits canal to the registered tables, so that rows and schemas of
+// other tables are neither decoded nor fetched.
+func (b *BinlogHandler) newCanal() error {
+	includes := append([]string{}, b.config.IncludeTableRegex...)
+	for _, s := range b.eventHandlers {
+		includes = append(includes, s.pattern)
+	}
+	for _, s := range b.rowHandlers {
+		includes = append(includes, s.pattern)
+	}
+	for _, s := range b.txHandlers {
+		includes = append(includes, s.pattern)
+	}
+	b.canalCfg.IncludeTableRegex = nil
+	seen := make(map[string]bool, len(includes))
+	for _, pattern := range includes {
+		if !seen[pattern] {
+			seen[pattern] = true
+			b.canalCfg.IncludeTableRegex = append(b.canalCfg.IncludeTableRegex, pattern)
+		}
+	}
+	b.canalCfg.ExcludeTableRegex = b.config.ExcludeTableRegex
+	c, err := canal.NewCanal(b.canalCfg)
 	if err != nil {
-		b.handlerError(err)
+		return err
 	}
-	return err
+	c.SetEventHandler(b)
+	b.canalCli = c
+	return nil
+}
+
+func (b *BinlogHandler) OnPosSynced(header *replication.EventHeader, pos mysql.Position, set mysql.GTIDSet, _ bool) error {
+	if b.dispatcher != nil {
+		return b.dispatcher.checkpoint(pos, set)
+	}
+	return b.savePosition(pos, set)
 }
 
 func (b *BinlogHandler) OnRotate(header *replication.EventHeader, event *replication.RotateEvent) error {
-	err := b.config.PosHandler.UpdatePos(mysql.Position{
+	pos := mysql.Position{
 		Pos:  uint32(event.Position),
 		Name: string(event.NextLogName),
-	})
+	}
+	if b.dispatcher != nil {
+		return b.dispatcher.checkpoint(pos, nil)
+	}
+	return b.savePosition(pos, nil)
+}
+
+// savePosition persists pos and set. An empty pos comes from closing canal
+// before it streamed, for example when start failed, and would overwrite the
+// stored position.
+func (b *BinlogHandler) savePosition(pos mysql.Position, set mysql.GTIDSet) error {
+	if pos.Name == "" {
+		return nil
+	}
+	err := b.config.PosHandler.UpdatePos(pos)
 	if err != nil {
+		err = &PositionError{Op: "save position", Position: pos, Err: err}
 		b.handlerError(err)
+		return err
+	}
+	if gtidHandler, ok := b.config.PosHandler.(GTIDPositionHandler); ok && set != nil && set.String() != "" {
+		err = gtidHandler.UpdateGTIDSet(set)
+		if err != nil {
+			err = &PositionError{Op: "save gtid set", GTIDSet: set, Err: err}
+			b.handlerError(err)
+		}
 	}
 	return err
 }
 
+func (b *BinlogHandler) OnTableChanged(header *replication.EventHeader, db string, table string) error {
+	key := db + "." + table
+	if len(b.handlersOf(key).events) == 0 {
+		return nil
+	}
+	t, err := b.canalCli.GetTable(db, table)
+	if err != nil {
+		// dropped or not readable now, OnRow will load the schema again
+		b.resetTable(key, nil)
+		return nil
+	}
+	b.resetTable(key, t)
+	return nil
+}
+
+// RegisterEventHandler subscribes e to DbName.TableName. Both names may use the
+// * and ? wildcards or be a regular expression starting with ^, a TableHandler
+// registered with RegisterTableHandler also receives the resolved table.
+// Several handlers may subscribe to the same table.
 func (b *BinlogHandler) RegisterEventHandler(e EventHandler) {
-	if b.running {
+	b.RegisterErrorEventHandler(eventHandlerAdapter{e})
+}
+
+func (b *BinlogHandler) RegisterTableHandler(e TableHandler) {
+	b.RegisterErrorEventHandler(tableHandlerAdapter{e})
+}
+
+func (b *BinlogHandler) RegisterErrorEventHandler(e ErrorEventHandler) {
+	if b.started() {
 		panic("can not register event handler after Run")
 	}
 	value := reflect.ValueOf(e.Schema())
@@ -176,46 +554,358 @@ func (b *BinlogHandler) RegisterEventHandler(e EventHandler) {
 	if kind != reflect.Ptr {
 		panic(fmt.Errorf("expected struct pointer, got %s", kind.String()))
 	}
-	key := e.DbName() + "." + e.TableName()
-	b.eventMap[key] = e
-	b.registerOnce(key)
+	matcher, err := newTableMatcher(e.DbName(), e.TableName())
+	if err != nil {
+		panic(err)
+	}
+	b.eventHandlers = append(b.eventHandlers, &eventSubscription{
+		tableMatcher: matcher,
+		handler:      e,
+	})
 }
 
-func (b *BinlogHandler) Run() error {
-	masterPos, err := b.canalCli.GetMasterPos()
-	if err != nil {
+// Run streams the binlog until ctx is cancelled, Close is called or canal
+// fails. On the way out the last synced position is persisted and the
+// PositionHandler is closed if it implements io.Closer. Run returns ctx.Err()
+// when ctx was cancelled, nil after Close and ErrClosed when the lister has
+// already run.
+func (b *BinlogHandler) Run(ctx context.Context) error {
+	b.mu.Lock()
+	if b.running || b.closed {
+		b.mu.Unlock()
+		return ErrClosed
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	b.running = true
+	b.ctx = runCtx
+	b.cancel = cancel
+	b.done = make(chan struct{})
+	b.mu.Unlock()
+	defer b.shutdown()
+
+	if err := b.newCanal(); err != nil {
+		return err
+	}
+	var failed <-chan struct{}
+	if b.config.Workers > 0 {
+		var spill *spill
+		if b.config.QueuePolicy == SpillWhenFull {
+			var err error
+			if spill, err = openSpill(b.config.SpillDir); err != nil {
+				return err
+			}
+		}
+		b.mu.Lock()
+		b.dispatcher = newDispatcher(b, b.config.Workers, b.config.QueueSize, spill)
+		b.mu.Unlock()
+		failed = b.dispatcher.failed
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- b.start()
+	}()
+	select {
+	case err := <-errCh:
 		return err
+	case <-failed:
+		b.canalCli.Close()
+		<-errCh
+		return b.dispatcher.failure()
+	case <-runCtx.Done():
+		// wait for the handler call in flight before closing anything
+		b.canalCli.Close()
+		err := <-errCh
+		if err == nil {
+			err = ctx.Err()
+		}
+		return err
+	}
+}
+
+// start streams from the position chosen by Config.StartMode. Positions which
+// are not resumed clear the stored GTID set, since it would take precedence
+// over the positions synced from then on.
+func (b *BinlogHandler) start() error {
+	if err := b.resumeSpool(); err != nil {
+		return err
+	}
+	switch b.config.StartMode {
+	case Latest:
+		return b.startLatest()
+	case Earliest:
+		files, err := b.binlogFiles()
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			return errors.New("binary logging is disabled")
+		}
+		return b.runFrom(mysql.Position{Name: files[0].name, Pos: 4})
+	case AtPosition:
+		if err := b.checkRetained(b.config.StartPosition); err != nil {
+			return err
+		}
+		return b.runFrom(b.config.StartPosition)
+	case AtGTID:
+		set, err := mysql.ParseGTIDSet(b.canalCfg.Flavor, b.config.StartGTID)
+		if err != nil {
+			return err
+		}
+		if err = b.checkGTIDRetained(set); err != nil {
+			return err
+		}
+		return b.canalCli.StartFromGTID(set)
+	case AtTimestamp:
+		pos, err := b.positionAt(b.config.StartTime)
+		if err != nil {
+			return err
+		}
+		return b.runFrom(pos)
+	}
+
+	if gtidHandler, ok := b.config.PosHandler.(GTIDPositionHandler); ok {
+		set, err := gtidHandler.GetLatestGTIDSet()
+		if err != nil {
+			return &PositionError{Op: "load gtid set", Err: err}
+		}
+		if set != nil && set.String() != "" {
+			if b.config.StartMode == Resume {
+				if err = b.checkGTIDRetained(set); err != nil {
+					return err
+				}
+			}
+			return b.canalCli.StartFromGTID(set)
+		}
 	}
 	pos, err := b.config.PosHandler.GetLatestPos()
 	if err != nil {
-		b.handlerError(err)
+		return &PositionError{Op: "load position", Err: err}
 	}
 	if pos.Name != "" {
+		if b.config.StartMode == Resume {
+			if err = b.checkRetained(pos); err != nil {
+				return err
+			}
+		}
 		return b.canalCli.RunFrom(pos)
 	}
-	defer b.Close()
-	b.running = true
-	return b.canalCli.RunFrom(masterPos)
+	if b.config.StartMode == Resume {
+		return ErrNoPosition
+	}
+	return b.startLatest()
+}
+
+// resumeSpool lets Config.Spool skip the events it stored after the stored
+// position when Run resumes from it, other start modes store every event
+// again.
+func (b *BinlogHandler) resumeSpool() error {
+	if b.config.Spool == nil {
+		return nil
+	}
+	var pos mysql.Position
+	if b.config.StartMode == ResumeOrLatest || b.config.StartMode == Resume {
+		var err error
+		if pos, err = b.config.PosHandler.GetLatestPos(); err != nil {
+			return &PositionError{Op: "load position", Err: err}
+		}
+	}
+	if err := b.config.Spool.resume(pos); err != nil {
+		return fmt.Errorf("resume spool: %w", err)
+	}
+	return nil
 }
 
+func (b *BinlogHandler) startLatest() error {
+	if b.config.UseGTID {
+		set, err := b.canalCli.GetMasterGTIDSet()
+		if err != nil {
+			return err
+		}
+		return b.canalCli.StartFromGTID(set)
+	}
+	pos, err := b.canalCli.GetMasterPos()
+	if err != nil {
+		return err
+	}
+	return b.runFrom(pos)
+}
+
+func (b *BinlogHandler) runFrom(pos mysql.Position) error {
+	if gtidHandler, ok := b.config.PosHandler.(GTIDPositionHandler); ok {
+		empty, err := mysql.ParseGTIDSet(b.canalCfg.Flavor, "")
+		if err != nil {
+			return err
+		}
+		if err = gtidHandler.UpdateGTIDSet(empty); err != nil {
+			return &PositionError{Op: "clear gtid set", Err: err}
+		}
+	}
+	return b.canalCli.RunFrom(pos)
+}
+
+// checkRetained fails with ErrPositionPurged when the binlog file of pos is
+// no longer listed by the server.
+func (b *BinlogHandler) checkRetained(pos mysql.Position) error {
+	files, err := b.binlogFiles()
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.name == pos.Name {
+			return nil
+		}
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("%w: %s, binary logging is disabled", ErrPositionPurged, pos)
+	}
+	return fmt.Errorf("%w: %s, the oldest binlog is %s", ErrPositionPurged, pos, files[0].name)
+}
+
+// checkGTIDRetained fails with ErrPositionPurged when the server purged
+// transactions missing in set. MariaDB does not report purged GTIDs, so its
+// sets are not checked.
+func (b *BinlogHandler) checkGTIDRetained(set mysql.GTIDSet) error {
+	if b.canalCfg.Flavor != mysql.MySQLFlavor {
+		return nil
+	}
+	r, err := b.canalCli.Execute("SELECT @@GLOBAL.gtid_purged")
+	if err != nil {
+		return err
+	}
+	value, err := r.GetString(0, 0)
+	if err != nil {
+		return err
+	}
+	purged, err := mysql.ParseGTIDSet(mysql.MySQLFlavor, value)
+	if err != nil {
+		return err
+	}
+	if !set.Contain(purged) {
+		return fmt.Errorf("%w: %s, purged %s", ErrPositionPurged, set, purged)
+	}
+	return nil
+}
+
+// shutdown runs once canal stopped, closing canal again persists the last
+// synced position after the last handler call returned. With Config.Workers
+// it is persisted once the workers drained their queues.
+func (b *BinlogHandler) shutdown() {
+	if b.canalCli != nil {
+		b.canalCli.Close()
+	}
+	if b.dispatcher != nil {
+		// stop retrying, the position stays before rows which failed
+		b.cancel()
+		if err := b.dispatcher.close(); err != nil {
+			b.handlerError(err)
+		}
+	}
+	if closer, ok := b.config.PosHandler.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			b.handlerError(&PositionError{Op: "close position handler", Err: err})
+		}
+	}
+	b.errors.close()
+	b.mu.Lock()
+	b.running = false
+	b.closed = true
+	close(b.done)
+	b.mu.Unlock()
+}
+
+// Close stops Run and waits until it returned. Run waits for the handler
+// and ErrorHandler calls in flight, so calling Close from them deadlocks;
+// they can cancel the context passed to Run instead.
 func (b *BinlogHandler) Close() {
+	b.mu.Lock()
 	if !b.running {
+		b.mu.Unlock()
 		return
 	}
-	b.running = false
-	b.canalCli.Close()
-	if handler, ok := b.config.PosHandler.(*DefaultPosHandler); ok {
-		handler.close()
+	cancel, done := b.cancel, b.done
+	b.mu.Unlock()
+	cancel()
+	<-done
+}
+
+func (b *BinlogHandler) started() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.running || b.closed
+}
+
+// QueueStats returns the state of the worker queues, it is zero unless
+// Config.Workers is set and Run started.
+func (b *BinlogHandler) QueueStats() QueueStats {
+	b.mu.Lock()
+	d := b.dispatcher
+	b.mu.Unlock()
+	if d == nil {
+		return QueueStats{}
 	}
-	close(b.errors)
+	return d.stats()
 }
+
 func (b *BinlogHandler) handlerError(err error) {
+	b.errors.report(err)
+}
+
+// Errors returns the reported errors, the channel is closed once Run returned.
+// It stays empty when Config.ErrorHandler is set.
+func (b *BinlogHandler) Errors() <-chan error {
+	return b.errors.ch
+}
+
+// DroppedErrors returns the number of errors which did not fit into the
+// Errors channel or were reported after it was closed.
+func (b *BinlogHandler) DroppedErrors() uint64 {
+	return atomic.LoadUint64(&b.errors.dropped)
+}
+
+// errorSink hands errors to the configured handler or buffers them in ch.
+// Sends hold mu, so that ch is never closed while a send is in progress.
+type errorSink struct {
+	dropped uint64
+	handler func(error)
+	mu      sync.RWMutex
+	closed  bool
+	ch      chan error
+}
+
+func newErrorSink(handler func(error), size int) *errorSink {
+	if handler != nil {
+		size = 0
+	}
+	return &errorSink{
+		handler: handler,
+		ch:      make(chan error, size),
+	}
+}
+
+func (s *errorSink) report(err error) {
+	if s.handler != nil {
+		s.handler(err)
+		return
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		atomic.AddUint64(&s.dropped, 1)
+		return
+	}
 	select {
-	case b.errors <- err:
+	case s.ch <- err:
 	default:
+		atomic.AddUint64(&s.dropped, 1)
 	}
 }
 
-func (b *BinlogHandler) Errors() <-chan error {
-	return b.errors
+func (s *errorSink) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
 }
@@ -1,118 +1,613 @@
 package binlog
 
 import (
+	"database/sql"
+	"encoding"
 	"fmt"
+	"math"
 	"reflect"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-mysql-org/go-mysql/canal"
 	"github.com/go-mysql-org/go-mysql/schema"
 	jsoniter "github.com/json-iterator/go"
-	// jsoniter "github.com/json-iterator/go"
 )
 
 type BinlogParser struct {
 	columnTag string
+	location  *time.Location
+	decoders  map[reflect.Type]DecodeFunc
+	lenient   bool
+	mu        sync.Mutex
 	onceMap   map[string]*tableSchema
 }
 
 type tableSchema struct {
-	once        sync.Once
+	mu          sync.RWMutex
+	table       *schema.Table
 	columnIdMap map[string]int
+	plans       map[reflect.Type]*decodePlan
 }
 
+// decodePlan maps the fields of one struct type onto the columns of one table
+// version, so rows are decoded without looking up tags and column names again.
+type decodePlan struct {
+	fields []fieldPlan
+}
+
+type fieldPlan struct {
+	index    []int
+	columnId int
+	set      fieldSetter
+}
+
+type fieldSetter func(m *BinlogParser, field reflect.Value, e *canal.RowsEvent, n int, columnId int) error
+
 func (m *BinlogParser) GetBinLogData(element any, e *rowsEvent, n int) error {
 	value := reflect.ValueOf(element).Elem()
-	num := value.NumField()
-	t := value.Type()
-	for k := 0; k < num; k++ {
-		columnName := t.Field(k).Tag.Get(m.columnTag)
-		columnId := m.getColumnIdByName(e, columnName)
-		name := value.Field(k).Type().Name()
-		switch name {
-		case "bool":
-			value.Field(k).SetBool(m.boolHelper(e.RowsEvent, n, columnId))
-		case "int64", "uint64", "int", "uint", "int32", "uint32", "int8", "uint8":
-			value.Field(k).SetInt(m.intHelper(e.RowsEvent, n, columnId))
-		case "string":
-			value.Field(k).SetString(m.stringHelper(e.RowsEvent, n, columnId))
-		case "Time":
-			timeVal := m.dateTimeHelper(e.RowsEvent, n, columnId)
-			value.Field(k).Set(reflect.ValueOf(timeVal))
-		case "float64", "float32":
-			value.Field(k).SetFloat(m.floatHelper(e.RowsEvent, n, columnId))
-		default:
-			newObject := reflect.New(value.Field(k).Type()).Interface()
-			json := m.stringHelper(e.RowsEvent, n, columnId)
-			err := jsoniter.Unmarshal([]byte(json), &newObject)
-			if err != nil {
-				return err
+	plan, err := m.getDecodePlan(e, value.Type())
+	if err != nil {
+		return err
+	}
+	for _, f := range plan.fields {
+		err := f.set(m, fieldByIndex(value, f.index), e.RowsEvent, n, f.columnId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldByIndex is reflect.Value.FieldByIndex allocating nil embedded pointers.
+func fieldByIndex(value reflect.Value, index []int) reflect.Value {
+	for i, k := range index {
+		if i > 0 && value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				value.Set(reflect.New(value.Type().Elem()))
+			}
+			value = value.Elem()
+		}
+		value = value.Field(k)
+	}
+	return value
+}
+
+func (m *BinlogParser) getDecodePlan(e *rowsEvent, t reflect.Type) (*decodePlan, error) {
+	val := m.tableSchemaOf(e.tableKey)
+	val.mu.RLock()
+	if val.table == e.Table {
+		if plan, ok := val.plans[t]; ok {
+			val.mu.RUnlock()
+			return plan, nil
+		}
+	}
+	val.mu.RUnlock()
+
+	val.mu.Lock()
+	defer val.mu.Unlock()
+	// canal replaces the *schema.Table after a DDL, so a different pointer
+	// means the columns may have moved.
+	if val.table != e.Table {
+		val.reset(e.Table)
+	}
+	if plan, ok := val.plans[t]; ok {
+		return plan, nil
+	}
+	plan, err := m.compileDecodePlan(val, e, t)
+	if err != nil {
+		return nil, err
+	}
+	val.plans[t] = plan
+	return plan, nil
+}
+
+// reset rebuilds the column mapping from table and drops the decode plans,
+// table is nil when the new schema is not known yet.
+func (val *tableSchema) reset(table *schema.Table) {
+	val.table = table
+	val.columnIdMap = nil
+	val.plans = make(map[reflect.Type]*decodePlan, 1)
+	if table == nil {
+		return
+	}
+	val.columnIdMap = make(map[string]int, len(table.Columns))
+	for id, value := range table.Columns {
+		val.columnIdMap[value.Name] = id
+	}
+}
+
+func (m *BinlogParser) tableSchemaOf(key string) *tableSchema {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	val, ok := m.onceMap[key]
+	if !ok {
+		val = &tableSchema{}
+		m.onceMap[key] = val
+	}
+	return val
+}
+
+// resetTable is called after a DDL changed the table key.
+func (m *BinlogParser) resetTable(key string, table *schema.Table) {
+	m.mu.Lock()
+	val, ok := m.onceMap[key]
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+	val.mu.Lock()
+	val.reset(table)
+	val.mu.Unlock()
+}
+
+// MappingError is returned when a struct field can not be mapped onto a column
+// of the table, Column is empty for fields without a tag.
+type MappingError struct {
+	Table  string
+	Field  string
+	Column string
+}
+
+func (e *MappingError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("field %s has no column tag for table %s", e.Field, e.Table)
+	}
+	return fmt.Sprintf("there is no column %s for field %s in table %s", e.Column, e.Field, e.Table)
+}
+
+// parseColumnTag splits a tag such as `db:"name,optional"`, optional fields
+// whose column is missing keep their zero value and inline struct fields are
+// mapped onto the columns starting with name.
+func parseColumnTag(tag string) (name string, optional bool, inline bool) {
+	name, opts, _ := strings.Cut(tag, ",")
+	for _, opt := range strings.Split(opts, ",") {
+		switch opt {
+		case "optional":
+			optional = true
+		case "inline":
+			inline = true
+		}
+	}
+	return name, optional, inline
+}
+
+func (m *BinlogParser) compileDecodePlan(val *tableSchema, e *rowsEvent, t reflect.Type) (*decodePlan, error) {
+	plan := &decodePlan{
+		fields: make([]fieldPlan, 0, t.NumField()),
+	}
+	err := m.compileFields(plan, val, e, t, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// compileFields appends the fields of t to plan, embedded structs without a
+// column name are flattened like database/sql scanners do.
+func (m *BinlogParser) compileFields(plan *decodePlan, val *tableSchema, e *rowsEvent, t reflect.Type, index []int, prefix string) error {
+	for k := 0; k < t.NumField(); k++ {
+		field := t.Field(k)
+		fieldIndex := append(index[:len(index):len(index)], k)
+		columnName, optional, inline := parseColumnTag(field.Tag.Get(m.columnTag))
+		if columnName == "-" {
+			continue
+		}
+		if field.Anonymous && columnName == "" || inline {
+			structType := field.Type
+			if structType.Kind() == reflect.Ptr && field.PkgPath == "" {
+				structType = structType.Elem()
+			}
+			if structType.Kind() == reflect.Struct {
+				err := m.compileFields(plan, val, e, structType, fieldIndex, prefix+columnName)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		columnId, ok := val.columnIdMap[prefix+columnName]
+		if !ok {
+			if optional || m.lenient {
+				continue
+			}
+			return &MappingError{
+				Table:  e.tableKey,
+				Field:  t.Name() + "." + field.Name,
+				Column: prefix + columnName,
 			}
-			value.Field(k).Set(reflect.ValueOf(newObject).Elem().Convert(value.Field(k).Type()))
 		}
+		plan.fields = append(plan.fields, fieldPlan{
+			index:    fieldIndex,
+			columnId: columnId,
+			set:      m.fieldSetterOf(field.Type, &e.Table.Columns[columnId]),
+		})
 	}
 	return nil
 }
 
-func (m *BinlogParser) dateTimeHelper(e *canal.RowsEvent, n int, columnId int) time.Time {
+// OverflowError is returned when a column value does not fit into the kind of
+// the struct field it is decoded into.
+type OverflowError struct {
+	Table  string
+	Column string
+	Value  any
+	Kind   reflect.Kind
+}
+
+func (e *OverflowError) Error() string {
+	return fmt.Sprintf("value %v of column %s in table %s overflows %s", e.Value, e.Column, e.Table, e.Kind)
+}
 
-	if e.Table.Columns[columnId].Type != schema.TYPE_TIMESTAMP {
-		panic("Not dateTime type")
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	scannerType  = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// fieldSetterOf picks the setter for a field type, decoders registered in
+// Config.Decoders and BinlogScanner implementations win over the built-in
+// kinds. Pointer fields stay nil and sql.Scanner fields such as sql.NullString
+// are scanned with nil when the column is NULL, other fields are left at their
+// zero value.
+func (m *BinlogParser) fieldSetterOf(t reflect.Type, column *schema.TableColumn) fieldSetter {
+	if decode, ok := m.decoders[t]; ok {
+		return decoderSetter(decode)
+	}
+	if reflect.PtrTo(t).Implements(binlogScannerType) {
+		return setBinlogScanner
+	}
+	if reflect.PtrTo(t).Implements(scannerType) {
+		return setScanner
 	}
-	t, _ := time.Parse("2006-01-02 15:04:05", e.Rows[n][columnId].(string))
+	// big.Rat, big.Float and most decimal libraries implement
+	// encoding.TextUnmarshaler.
+	if column.Type == schema.TYPE_DECIMAL && t != timeType && reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return setText
+	}
+	switch t {
+	case timeType:
+		return setTime
+	case reflect.PtrTo(timeType):
+		return setTimePtr
+	case durationType:
+		return setDuration
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return ptrSetter(m.fieldSetterOf(t.Elem(), column))
+	case reflect.Bool:
+		return setBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return setInt
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return setUint
+	case reflect.String:
+		return setString
+	case reflect.Float32, reflect.Float64:
+		return setFloat
+	default:
+		return setJson
+	}
+}
 
-	return t
+func ptrSetter(elemSetter fieldSetter) fieldSetter {
+	return func(m *BinlogParser, field reflect.Value, e *canal.RowsEvent, n int, columnId int) error {
+		if e.Rows[n][columnId] == nil {
+			field.Set(reflect.Zero(field.Type()))
+			return nil
+		}
+		elem := reflect.New(field.Type().Elem())
+		err := elemSetter(m, elem.Elem(), e, n, columnId)
+		if err != nil {
+			return err
+		}
+		field.Set(elem)
+		return nil
+	}
 }
 
-func (m *BinlogParser) intHelper(e *canal.RowsEvent, n int, columnId int) int64 {
+func setScanner(m *BinlogParser, field reflect.Value, e *canal.RowsEvent, n int, columnId int) error {
+	value, err := m.driverValueHelper(e, n, columnId)
+	if err != nil {
+		return err
+	}
+	return field.Addr().Interface().(sql.Scanner).Scan(value)
+}
 
-	if e.Table.Columns[columnId].Type != schema.TYPE_NUMBER {
-		return 0
+func setBool(m *BinlogParser, field reflect.Value, e *canal.RowsEvent, n int, columnId int) error {
+	val, _ := m.intHelper(e, n, columnId)
+	field.SetBool(val == 1)
+	return nil
+}
+
+func setInt(m *BinlogParser, field reflect.Value, e *canal.RowsEvent, n int, columnId int) error {
+	val, unsigned := m.intHelper(e, n, columnId)
+	if unsigned && uint64(val) > math.MaxInt64 || field.OverflowInt(val) {
+		return newOverflowError(e, n, columnId, field.Kind())
+	}
+	field.SetInt(val)
+	return nil
+}
+
+func setUint(m *BinlogParser, field reflect.Value, e *canal.RowsEvent, n int, columnId int) error {
+	val, unsigned := m.intHelper(e, n, columnId)
+	if !unsigned && val < 0 || field.OverflowUint(uint64(val)) {
+		return newOverflowError(e, n, columnId, field.Kind())
+	}
+	field.SetUint(uint64(val))
+	return nil
+}
+
+func newOverflowError(e *canal.RowsEvent, n int, columnId int, kind reflect.Kind) error {
+	return &OverflowError{
+		Table:  e.Table.Schema + "." + e.Table.Name,
+		Column: e.Table.Columns[columnId].Name,
+		Value:  e.Rows[n][columnId],
+		Kind:   kind,
+	}
+}
+
+func setString(m *BinlogParser, field reflect.Value, e *canal.RowsEvent, n int, columnId int) error {
+	field.SetString(m.stringHelper(e, n, columnId))
+	return nil
+}
+
+func setTime(m *BinlogParser, field reflect.Value, e *canal.RowsEvent, n int, columnId int) error {
+	if e.Rows[n][columnId] == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+	timeVal, err := m.dateTimeHelper(e, n, columnId)
+	if err != nil {
+		return err
+	}
+	field.Set(reflect.ValueOf(timeVal))
+	return nil
+}
+
+func setTimePtr(m *BinlogParser, field reflect.Value, e *canal.RowsEvent, n int, columnId int) error {
+	if e.Rows[n][columnId] == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+	timeVal, err := m.dateTimeHelper(e, n, columnId)
+	if err != nil {
+		return err
+	}
+	if timeVal.IsZero() {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+	field.Set(reflect.ValueOf(&timeVal))
+	return nil
+}
+
+func setDuration(m *BinlogParser, field reflect.Value, e *canal.RowsEvent, n int, columnId int) error {
+	column := &e.Table.Columns[columnId]
+	if column.Type != schema.TYPE_TIME {
+		return setInt(m, field, e, n, columnId)
+	}
+	value, ok := e.Rows[n][columnId].(string)
+	if !ok {
+		field.SetInt(0)
+		return nil
+	}
+	d, err := parseTimeColumn(value)
+	if err != nil {
+		return err
+	}
+	field.SetInt(int64(d))
+	return nil
+}
+
+func setFloat(m *BinlogParser, field reflect.Value, e *canal.RowsEvent, n int, columnId int) error {
+	val, err := m.floatHelper(e, n, columnId)
+	if err != nil {
+		return err
+	}
+	if field.OverflowFloat(val) {
+		return newOverflowError(e, n, columnId, field.Kind())
+	}
+	field.SetFloat(val)
+	return nil
+}
+
+func setText(m *BinlogParser, field reflect.Value, e *canal.RowsEvent, n int, columnId int) error {
+	if e.Rows[n][columnId] == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+	return field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(m.stringHelper(e, n, columnId)))
+}
+
+func setJson(m *BinlogParser, field reflect.Value, e *canal.RowsEvent, n int, columnId int) error {
+	if e.Rows[n][columnId] == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+	newObject := reflect.New(field.Type()).Interface()
+	json := m.stringHelper(e, n, columnId)
+	err := jsoniter.Unmarshal([]byte(json), &newObject)
+	if err != nil {
+		return err
+	}
+	field.Set(reflect.ValueOf(newObject).Elem().Convert(field.Type()))
+	return nil
+}
+
+// dateTimeHelper decodes DATETIME, TIMESTAMP, DATE, TIME and YEAR columns in
+// the configured location. Zero dates such as 0000-00-00 are returned as the
+// zero time.Time, TIME columns are added to 0000-01-01.
+func (m *BinlogParser) dateTimeHelper(e *canal.RowsEvent, n int, columnId int) (time.Time, error) {
+	column := &e.Table.Columns[columnId]
+	switch v := e.Rows[n][columnId].(type) {
+	case time.Time:
+		return v.In(m.location), nil
+	case string:
+		switch column.Type {
+		case schema.TYPE_DATETIME, schema.TYPE_TIMESTAMP:
+			if strings.HasPrefix(v, "0000-00-00") {
+				return time.Time{}, nil
+			}
+			return time.ParseInLocation("2006-01-02 15:04:05.999999999", v, m.location)
+		case schema.TYPE_DATE:
+			if strings.HasPrefix(v, "0000-00-00") {
+				return time.Time{}, nil
+			}
+			return time.ParseInLocation("2006-01-02", v, m.location)
+		case schema.TYPE_TIME:
+			d, err := parseTimeColumn(v)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return time.Date(0, 1, 1, 0, 0, 0, 0, m.location).Add(d), nil
+		}
+	default:
+		if column.Type == schema.TYPE_NUMBER && strings.HasPrefix(column.RawType, "year") {
+			year, _ := m.intHelper(e, n, columnId)
+			if year == 0 {
+				return time.Time{}, nil
+			}
+			return time.Date(int(year), 1, 1, 0, 0, 0, 0, m.location), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("can not decode column %s of type %s in table %s.%s into time.Time", column.Name, column.RawType, e.Table.Schema, e.Table.Name)
+}
+
+// parseTimeColumn parses a TIME value such as -838:59:59.000000.
+func parseTimeColumn(value string) (time.Duration, error) {
+	s := strings.TrimPrefix(value, "-")
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid TIME value %q", value)
+	}
+	sec, frac, _ := strings.Cut(parts[2], ".")
+	hours, err1 := strconv.Atoi(parts[0])
+	minutes, err2 := strconv.Atoi(parts[1])
+	seconds, err3 := strconv.Atoi(sec)
+	nanos, err4 := strconv.Atoi((frac + "000000000")[:9])
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return 0, fmt.Errorf("invalid TIME value %q", value)
+	}
+	d := time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute +
+		time.Duration(seconds)*time.Second + time.Duration(nanos)
+	if len(s) != len(value) {
+		d = -d
+	}
+	return d, nil
+}
+
+// intHelper returns the bits of an integer column, unsigned reports whether
+// they have to be read as uint64.
+func (m *BinlogParser) intHelper(e *canal.RowsEvent, n int, columnId int) (val int64, unsigned bool) {
+	column := &e.Table.Columns[columnId]
+	switch column.Type {
+	case schema.TYPE_NUMBER, schema.TYPE_MEDIUM_INT, schema.TYPE_BIT:
+	default:
+		return 0, false
 	}
 
 	switch v := e.Rows[n][columnId].(type) {
 	case int8:
-		return int64(v)
+		if column.IsUnsigned {
+			return int64(uint8(v)), true
+		}
+		return int64(v), false
+	case int16:
+		if column.IsUnsigned {
+			return int64(uint16(v)), true
+		}
+		return int64(v), false
 	case int32:
-		return int64(v)
+		if column.IsUnsigned && column.Type == schema.TYPE_MEDIUM_INT && v < 0 {
+			return int64(v) + 1<<24, true
+		}
+		if column.IsUnsigned {
+			return int64(uint32(v)), true
+		}
+		return int64(v), false
 	case int64:
-		return e.Rows[n][columnId].(int64)
+		return v, column.IsUnsigned
 	case int:
-		return int64(e.Rows[n][columnId].(int))
+		return int64(v), column.IsUnsigned
 	case uint8:
-		return int64(e.Rows[n][columnId].(uint8))
+		return int64(v), true
 	case uint16:
-		return int64(e.Rows[n][columnId].(uint16))
+		return int64(v), true
 	case uint32:
-		return int64(e.Rows[n][columnId].(uint32))
+		return int64(v), true
 	case uint64:
-		return int64(e.Rows[n][columnId].(uint64))
+		return int64(v), true
 	case uint:
-		return int64(e.Rows[n][columnId].(uint))
+		return int64(v), true
 	}
-	return 0
+	return 0, false
 }
 
-func (m *BinlogParser) floatHelper(e *canal.RowsEvent, n int, columnId int) float64 {
-
-	if e.Table.Columns[columnId].Type != schema.TYPE_FLOAT {
-		panic("Not float type")
-	}
-
-	switch e.Rows[n][columnId].(type) {
-	case float32:
-		return float64(e.Rows[n][columnId].(float32))
-	case float64:
-		return float64(e.Rows[n][columnId].(float64))
+func (m *BinlogParser) floatHelper(e *canal.RowsEvent, n int, columnId int) (float64, error) {
+	column := &e.Table.Columns[columnId]
+	switch column.Type {
+	case schema.TYPE_FLOAT:
+		switch v := e.Rows[n][columnId].(type) {
+		case float32:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		}
+		return 0, nil
+	case schema.TYPE_DECIMAL:
+		if e.Rows[n][columnId] == nil {
+			return 0, nil
+		}
+		return strconv.ParseFloat(m.stringHelper(e, n, columnId), 64)
+	case schema.TYPE_NUMBER, schema.TYPE_MEDIUM_INT:
+		val, unsigned := m.intHelper(e, n, columnId)
+		if unsigned {
+			return float64(uint64(val)), nil
+		}
+		return float64(val), nil
 	}
-	return float64(0)
+	return 0, fmt.Errorf("can not decode column %s of type %s in table %s.%s into float", column.Name, column.RawType, e.Table.Schema, e.Table.Name)
 }
 
-func (m *BinlogParser) boolHelper(e *canal.RowsEvent, n int, columnId int) bool {
-
-	val := m.intHelper(e, n, columnId)
-	return val == 1
+// driverValueHelper converts a column value into one of the types accepted by
+// sql.Scanner.
+func (m *BinlogParser) driverValueHelper(e *canal.RowsEvent, n int, columnId int) (any, error) {
+	value := e.Rows[n][columnId]
+	if value == nil {
+		return nil, nil
+	}
+	switch e.Table.Columns[columnId].Type {
+	case schema.TYPE_NUMBER, schema.TYPE_MEDIUM_INT, schema.TYPE_BIT:
+		val, unsigned := m.intHelper(e, n, columnId)
+		if unsigned {
+			return uint64(val), nil
+		}
+		return val, nil
+	case schema.TYPE_FLOAT:
+		return m.floatHelper(e, n, columnId)
+	case schema.TYPE_ENUM, schema.TYPE_DECIMAL:
+		return m.stringHelper(e, n, columnId), nil
+	case schema.TYPE_DATETIME, schema.TYPE_TIMESTAMP, schema.TYPE_DATE:
+		t, err := m.dateTimeHelper(e, n, columnId)
+		if err != nil || t.IsZero() {
+			return nil, err
+		}
+		return t, nil
+	}
+	switch value := value.(type) {
+	case []byte, string, int64, float64, bool, time.Time:
+		return value, nil
+	}
+	return fmt.Sprint(value), nil
 }
 
 func (m *BinlogParser) stringHelper(e *canal.RowsEvent, n int, columnId int) string {
@@ -138,32 +633,9 @@ func (m *BinlogParser) stringHelper(e *canal.RowsEvent, n int, columnId int) str
 		return string(value)
 	case string:
 		return value
+	case fmt.Stringer:
+		// decimal.Decimal when Config.UseDecimal is set
+		return value.String()
 	}
 	return ""
 }
-
-func (m *BinlogParser) getColumnIdByName(e *rowsEvent, columnName string) int {
-	val, ok := m.onceMap[e.tableKey]
-	if !ok {
-		panic("No table schema:" + e.tableKey)
-	}
-	if val.columnIdMap == nil {
-		val.once.Do(func() {
-			val.columnIdMap = make(map[string]int, len(e.Table.Columns))
-			for id, value := range e.Table.Columns {
-				val.columnIdMap[value.Name] = id
-			}
-		})
-	}
-	id, ok := val.columnIdMap[columnName]
-	if !ok {
-		panic(fmt.Sprintf("There is no column %s in table %s.%s", columnName, e.Table.Schema, e.Table.Name))
-	}
-	return id
-}
-
-func (m *BinlogParser) registerOnce(key string) {
-	m.onceMap[key] = &tableSchema{
-		once: sync.Once{},
-	}
-}
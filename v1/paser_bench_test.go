@@ -0,0 +1,150 @@
+package binlog
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+type benchRow struct {
+	Id      int64   `db:"id"`
+	Name    string  `db:"name"`
+	Email   string  `db:"email"`
+	Age     int32   `db:"age"`
+	Score   float64 `db:"score"`
+	Active  bool    `db:"active"`
+	Balance int64   `db:"balance"`
+	Country string  `db:"country"`
+}
+
+func newBenchEvent(rows int) *rowsEvent {
+	table := &schema.Table{
+		Schema: "bench",
+		Name:   "users",
+		Columns: []schema.TableColumn{
+			{Name: "id", Type: schema.TYPE_NUMBER},
+			{Name: "name", Type: schema.TYPE_STRING},
+			{Name: "email", Type: schema.TYPE_STRING},
+			{Name: "age", Type: schema.TYPE_NUMBER},
+			{Name: "score", Type: schema.TYPE_FLOAT},
+			{Name: "active", Type: schema.TYPE_NUMBER},
+			{Name: "balance", Type: schema.TYPE_NUMBER},
+			{Name: "country", Type: schema.TYPE_STRING},
+		},
+		PKColumns: []int{0},
+	}
+	e := &canal.RowsEvent{Table: table, Action: canal.InsertAction}
+	for i := 0; i < rows; i++ {
+		e.Rows = append(e.Rows, []any{
+			int64(i), fmt.Sprintf("user%d", i), fmt.Sprintf("user%d@example.com", i),
+			int32(i % 100), float64(i) / 3, int8(i % 2), int64(i * 100), "NL",
+		})
+	}
+	return &rowsEvent{RowsEvent: e, tableKey: "bench.users"}
+}
+
+func newBenchParser() *BinlogParser {
+	return &BinlogParser{
+		columnTag: "db",
+		location:  time.UTC,
+		onceMap:   make(map[string]*tableSchema),
+	}
+}
+
+// legacyParser is the decoder before decode plans: every row reads the tag of
+// every field, looks its column up by name and switches on the type name.
+type legacyParser struct {
+	*BinlogParser
+	once        sync.Once
+	columnIdMap map[string]int
+}
+
+func (m *legacyParser) getColumnIdByName(e *rowsEvent, columnName string) int {
+	m.once.Do(func() {
+		m.columnIdMap = make(map[string]int, len(e.Table.Columns))
+		for id, value := range e.Table.Columns {
+			m.columnIdMap[value.Name] = id
+		}
+	})
+	id, ok := m.columnIdMap[columnName]
+	if !ok {
+		panic(fmt.Sprintf("There is no column %s in table %s", columnName, e.tableKey))
+	}
+	return id
+}
+
+func (m *legacyParser) GetBinLogData(element any, e *rowsEvent, n int) error {
+	value := reflect.ValueOf(element).Elem()
+	num := value.NumField()
+	t := value.Type()
+	for k := 0; k < num; k++ {
+		columnName := t.Field(k).Tag.Get(m.columnTag)
+		columnId := m.getColumnIdByName(e, columnName)
+		switch value.Field(k).Type().Name() {
+		case "bool":
+			val, _ := m.intHelper(e.RowsEvent, n, columnId)
+			value.Field(k).SetBool(val == 1)
+		case "int64", "int", "int32", "int8":
+			val, _ := m.intHelper(e.RowsEvent, n, columnId)
+			value.Field(k).SetInt(val)
+		case "string":
+			value.Field(k).SetString(m.stringHelper(e.RowsEvent, n, columnId))
+		case "float64", "float32":
+			val, err := m.floatHelper(e.RowsEvent, n, columnId)
+			if err != nil {
+				return err
+			}
+			value.Field(k).SetFloat(val)
+		default:
+			return fmt.Errorf("unsupported field %s", t.Field(k).Name)
+		}
+	}
+	return nil
+}
+
+func TestLegacyParserMatchesDecodePlan(t *testing.T) {
+	e := newBenchEvent(16)
+	parser := newBenchParser()
+	legacy := &legacyParser{BinlogParser: newBenchParser()}
+	for n := range e.Rows {
+		var got, want benchRow
+		if err := parser.GetBinLogData(&got, e, n); err != nil {
+			t.Fatal(err)
+		}
+		if err := legacy.GetBinLogData(&want, e, n); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("row %d: plan decoded %+v, legacy decoded %+v", n, got, want)
+		}
+	}
+}
+
+func BenchmarkGetBinLogData(b *testing.B) {
+	e := newBenchEvent(1024)
+	b.Run("plan", func(b *testing.B) {
+		parser := newBenchParser()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var row benchRow
+			if err := parser.GetBinLogData(&row, e, i%len(e.Rows)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("legacy", func(b *testing.B) {
+		parser := &legacyParser{BinlogParser: newBenchParser()}
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var row benchRow
+			if err := parser.GetBinLogData(&row, e, i%len(e.Rows)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
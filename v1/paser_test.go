@@ -0,0 +1,269 @@
+package binlog
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+// newColumnsEvent returns a rows event of table test.t with one row.
+func newColumnsEvent(columns []schema.TableColumn, row ...any) *rowsEvent {
+	table := &schema.Table{Schema: "test", Name: "t", Columns: columns}
+	return &rowsEvent{
+		RowsEvent: &canal.RowsEvent{Table: table, Action: canal.InsertAction, Rows: [][]any{row}},
+		tableKey:  "test.t",
+	}
+}
+
+type columnTest struct {
+	name   string
+	column schema.TableColumn
+	value  any
+	// dst points to a struct whose only field V is tagged v
+	dst  any
+	want any
+	err  bool
+}
+
+func runColumnTests(t *testing.T, parser *BinlogParser, tests []columnTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.column.Name = "v"
+			e := newColumnsEvent([]schema.TableColumn{tt.column}, tt.value)
+			err := parser.GetBinLogData(tt.dst, e, 0)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("decoded %v, want an error", reflect.ValueOf(tt.dst).Elem().Field(0))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := reflect.ValueOf(tt.dst).Elem().Field(0).Interface()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("decoded %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeIntegers(t *testing.T) {
+	number := schema.TableColumn{Type: schema.TYPE_NUMBER}
+	unsigned := schema.TableColumn{Type: schema.TYPE_NUMBER, IsUnsigned: true}
+	mediumUnsigned := schema.TableColumn{Type: schema.TYPE_MEDIUM_INT, IsUnsigned: true}
+	double := schema.TableColumn{Type: schema.TYPE_FLOAT}
+	runColumnTests(t, newBenchParser(), []columnTest{
+		{name: "int8", column: number, value: int8(-5), dst: &struct {
+			V int8 `db:"v"`
+		}{}, want: int8(-5)},
+		{name: "int8 overflow", column: number, value: int16(300), dst: &struct {
+			V int8 `db:"v"`
+		}{}, err: true},
+		{name: "unsigned tinyint", column: unsigned, value: int8(-1), dst: &struct {
+			V uint8 `db:"v"`
+		}{}, want: uint8(255)},
+		{name: "unsigned tinyint into int8", column: unsigned, value: int8(-1), dst: &struct {
+			V int8 `db:"v"`
+		}{}, err: true},
+		{name: "unsigned int", column: unsigned, value: int32(-1), dst: &struct {
+			V int64 `db:"v"`
+		}{}, want: int64(math.MaxUint32)},
+		{name: "unsigned int into int32", column: unsigned, value: int32(-1), dst: &struct {
+			V int32 `db:"v"`
+		}{}, err: true},
+		{name: "unsigned mediumint", column: mediumUnsigned, value: int32(-1), dst: &struct {
+			V uint32 `db:"v"`
+		}{}, want: uint32(1<<24 - 1)},
+		{name: "unsigned bigint", column: unsigned, value: uint64(math.MaxUint64), dst: &struct {
+			V uint64 `db:"v"`
+		}{}, want: uint64(math.MaxUint64)},
+		{name: "unsigned bigint into int64", column: unsigned, value: uint64(math.MaxUint64), dst: &struct {
+			V int64 `db:"v"`
+		}{}, err: true},
+		{name: "negative into uint", column: number, value: int64(-1), dst: &struct {
+			V uint `db:"v"`
+		}{}, err: true},
+		{name: "bool", column: number, value: int8(1), dst: &struct {
+			V bool `db:"v"`
+		}{}, want: true},
+		{name: "double into float32 overflow", column: double, value: 1e300, dst: &struct {
+			V float32 `db:"v"`
+		}{}, err: true},
+	})
+}
+
+func TestDecodeNull(t *testing.T) {
+	number := schema.TableColumn{Type: schema.TYPE_NUMBER}
+	str := schema.TableColumn{Type: schema.TYPE_STRING}
+	datetime := schema.TableColumn{Type: schema.TYPE_DATETIME}
+	seven := int64(7)
+	runColumnTests(t, newBenchParser(), []columnTest{
+		{name: "nil pointer", column: number, value: nil, dst: &struct {
+			V *int64 `db:"v"`
+		}{V: &seven}, want: (*int64)(nil)},
+		{name: "pointer", column: number, value: int64(7), dst: &struct {
+			V *int64 `db:"v"`
+		}{}, want: &seven},
+		{name: "invalid NullInt64", column: number, value: nil, dst: &struct {
+			V sql.NullInt64 `db:"v"`
+		}{V: sql.NullInt64{Int64: 7, Valid: true}}, want: sql.NullInt64{}},
+		{name: "NullInt64", column: number, value: int64(7), dst: &struct {
+			V sql.NullInt64 `db:"v"`
+		}{}, want: sql.NullInt64{Int64: 7, Valid: true}},
+		{name: "NullString", column: str, value: "x", dst: &struct {
+			V sql.NullString `db:"v"`
+		}{}, want: sql.NullString{String: "x", Valid: true}},
+		{name: "zero date into NullTime", column: datetime, value: "0000-00-00 00:00:00", dst: &struct {
+			V sql.NullTime `db:"v"`
+		}{}, want: sql.NullTime{}},
+	})
+}
+
+func TestDecodeTemporal(t *testing.T) {
+	datetime := schema.TableColumn{Type: schema.TYPE_DATETIME}
+	date := schema.TableColumn{Type: schema.TYPE_DATE}
+	timeColumn := schema.TableColumn{Type: schema.TYPE_TIME}
+	year := schema.TableColumn{Type: schema.TYPE_NUMBER, RawType: "year(4)"}
+	zone := time.FixedZone("UTC+2", 2*60*60)
+	parser := newBenchParser()
+	parser.location = zone
+	runColumnTests(t, parser, []columnTest{
+		{name: "fractional datetime", column: datetime, value: "2024-03-01 12:34:56.789", dst: &struct {
+			V time.Time `db:"v"`
+		}{}, want: time.Date(2024, 3, 1, 12, 34, 56, 789000000, zone)},
+		{name: "datetime in location", column: datetime, value: "2024-03-01 12:34:56", dst: &struct {
+			V time.Time `db:"v"`
+		}{}, want: time.Date(2024, 3, 1, 12, 34, 56, 0, zone)},
+		{name: "time.Time converted to location", column: datetime, value: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), dst: &struct {
+			V time.Time `db:"v"`
+		}{}, want: time.Date(2024, 3, 1, 12, 0, 0, 0, zone)},
+		{name: "zero datetime", column: datetime, value: "0000-00-00 00:00:00", dst: &struct {
+			V time.Time `db:"v"`
+		}{}, want: time.Time{}},
+		{name: "zero datetime into pointer", column: datetime, value: "0000-00-00 00:00:00", dst: &struct {
+			V *time.Time `db:"v"`
+		}{}, want: (*time.Time)(nil)},
+		{name: "invalid datetime", column: datetime, value: "yesterday", dst: &struct {
+			V time.Time `db:"v"`
+		}{}, err: true},
+		{name: "date", column: date, value: "2024-03-01", dst: &struct {
+			V time.Time `db:"v"`
+		}{}, want: time.Date(2024, 3, 1, 0, 0, 0, 0, zone)},
+		{name: "zero date", column: date, value: "0000-00-00", dst: &struct {
+			V time.Time `db:"v"`
+		}{}, want: time.Time{}},
+		{name: "negative time", column: timeColumn, value: "-838:59:59.000000", dst: &struct {
+			V time.Duration `db:"v"`
+		}{}, want: -(838*time.Hour + 59*time.Minute + 59*time.Second)},
+		{name: "time into time.Time", column: timeColumn, value: "12:00:01.5", dst: &struct {
+			V time.Time `db:"v"`
+		}{}, want: time.Date(0, 1, 1, 12, 0, 1, 500000000, zone)},
+		{name: "invalid time", column: timeColumn, value: "12:00", dst: &struct {
+			V time.Duration `db:"v"`
+		}{}, err: true},
+		{name: "year", column: year, value: int64(2024), dst: &struct {
+			V time.Time `db:"v"`
+		}{}, want: time.Date(2024, 1, 1, 0, 0, 0, 0, zone)},
+		{name: "zero year", column: year, value: int64(0), dst: &struct {
+			V time.Time `db:"v"`
+		}{}, want: time.Time{}},
+	})
+}
+
+func TestDecodeDecimal(t *testing.T) {
+	decimal := schema.TableColumn{Name: "v", Type: schema.TYPE_DECIMAL}
+	var row struct {
+		Rat   big.Rat `db:"v"`
+		Float float64 `db:"v"`
+	}
+	e := newColumnsEvent([]schema.TableColumn{decimal}, "12.345")
+	if err := newBenchParser().GetBinLogData(&row, e, 0); err != nil {
+		t.Fatal(err)
+	}
+	if row.Rat.RatString() != "2469/200" || row.Float != 12.345 {
+		t.Fatalf("decoded %s and %v", row.Rat.RatString(), row.Float)
+	}
+}
+
+func TestDecodeMappingError(t *testing.T) {
+	columns := []schema.TableColumn{{Name: "id", Type: schema.TYPE_NUMBER}}
+	tests := []struct {
+		name   string
+		dst    any
+		column string
+	}{
+		{"missing column", &struct {
+			Missing string `db:"missing"`
+		}{}, "missing"},
+		{"field without tag", &struct {
+			Id int64
+		}{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newBenchParser().GetBinLogData(tt.dst, newColumnsEvent(columns, int64(1)), 0)
+			var mappingErr *MappingError
+			if !errors.As(err, &mappingErr) {
+				t.Fatalf("got %v, want a *MappingError", err)
+			}
+			if mappingErr.Column != tt.column || mappingErr.Table != "test.t" {
+				t.Fatalf("got %+v", mappingErr)
+			}
+
+			lenient := newBenchParser()
+			lenient.lenient = true
+			if err = lenient.GetBinLogData(tt.dst, newColumnsEvent(columns, int64(1)), 0); err != nil {
+				t.Fatalf("lenient decoding failed: %v", err)
+			}
+		})
+	}
+}
+
+type tagAddress struct {
+	City string `db:"city"`
+	Zip  string `db:"zip"`
+}
+
+type tagBase struct {
+	Id int64 `db:"id"`
+}
+
+type tagRow struct {
+	tagBase
+	Name    string     `db:"name"`
+	Skipped string     `db:"-"`
+	Missing string     `db:"missing,optional"`
+	Address tagAddress `db:"addr_,inline"`
+}
+
+func TestDecodeTags(t *testing.T) {
+	e := newColumnsEvent([]schema.TableColumn{
+		{Name: "id", Type: schema.TYPE_NUMBER},
+		{Name: "name", Type: schema.TYPE_STRING},
+		{Name: "addr_city", Type: schema.TYPE_STRING},
+		{Name: "addr_zip", Type: schema.TYPE_STRING},
+	}, int64(1), "ann", "Utrecht", "3511")
+	row := tagRow{Skipped: "keep", Missing: "keep"}
+	if err := newBenchParser().GetBinLogData(&row, e, 0); err != nil {
+		t.Fatal(err)
+	}
+	want := tagRow{
+		tagBase: tagBase{Id: 1},
+		Name:    "ann",
+		Skipped: "keep",
+		Missing: "keep",
+		Address: tagAddress{City: "Utrecht", Zip: "3511"},
+	}
+	if row != want {
+		t.Fatalf("decoded %+v, want %+v", row, want)
+	}
+}
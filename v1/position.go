@@ -2,6 +2,8 @@ package binlog
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 
 	"github.com/dgraph-io/badger/v3"
 	"github.com/go-mysql-org/go-mysql/mysql"
@@ -9,12 +11,54 @@ import (
 
 type PositionHandler interface {
 	UpdatePos(pos mysql.Position) error
+	// GetLatestPos returns a zero Position when no position has been stored
+	// yet, an error fails Run.
 	GetLatestPos() (mysql.Position, error)
 }
 
+// GTIDPositionHandler is implemented by position handlers which also persist
+// the executed GTID set. A stored GTID set takes precedence over the file
+// position on Run, so the stream survives a primary failover.
+type GTIDPositionHandler interface {
+	PositionHandler
+	UpdateGTIDSet(set mysql.GTIDSet) error
+	// GetLatestGTIDSet returns nil when no GTID set has been stored yet.
+	GetLatestGTIDSet() (mysql.GTIDSet, error)
+}
+
+// PositionError is reported when the PositionHandler failed to save, load or
+// close the position, Op names the failed operation.
+type PositionError struct {
+	Op       string
+	Position mysql.Position
+	GTIDSet  mysql.GTIDSet
+	Err      error
+}
+
+func (e *PositionError) Error() string {
+	switch {
+	case e.GTIDSet != nil:
+		return fmt.Sprintf("%s %s: %v", e.Op, e.GTIDSet, e.Err)
+	case e.Position.Name != "":
+		return fmt.Sprintf("%s %s: %v", e.Op, e.Position, e.Err)
+	default:
+		return fmt.Sprintf("%s: %v", e.Op, e.Err)
+	}
+}
+
+func (e *PositionError) Unwrap() error {
+	return e.Err
+}
+
 type DefaultPosHandler struct {
 	badgerCli *badger.DB
 	dataKey   []byte
+	gtidKey   []byte
+}
+
+type gtidPos struct {
+	Flavor string
+	GTID   string
 }
 
 func NewDefaultPosHandler(dir string) (*DefaultPosHandler, error) {
@@ -25,11 +69,12 @@ func NewDefaultPosHandler(dir string) (*DefaultPosHandler, error) {
 	return &DefaultPosHandler{
 		badgerCli: db,
 		dataKey:   []byte("binlog_pos"),
+		gtidKey:   []byte("binlog_gtid"),
 	}, nil
 }
 
-func (d *DefaultPosHandler) close() {
-	d.badgerCli.Close()
+func (d *DefaultPosHandler) Close() error {
+	return d.badgerCli.Close()
 }
 
 func (d *DefaultPosHandler) UpdatePos(pos mysql.Position) error {
@@ -55,5 +100,52 @@ func (d *DefaultPosHandler) GetLatestPos() (pos mysql.Position, err error) {
 			return nil
 		})
 	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return mysql.Position{}, nil
+	}
+	return
+}
+
+func (d *DefaultPosHandler) UpdateGTIDSet(set mysql.GTIDSet) error {
+	data := gtidPos{
+		Flavor: mysql.MySQLFlavor,
+		GTID:   set.String(),
+	}
+	if _, ok := set.(*mysql.MariadbGTIDSet); ok {
+		data.Flavor = mysql.MariaDBFlavor
+	}
+	return d.badgerCli.Update(func(txn *badger.Txn) error {
+		gtidJson, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		return txn.Set(d.gtidKey, gtidJson)
+	})
+}
+
+func (d *DefaultPosHandler) GetLatestGTIDSet() (set mysql.GTIDSet, err error) {
+	err = d.badgerCli.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(d.gtidKey)
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			var data gtidPos
+			if len(val) == 0 {
+				return nil
+			}
+			if err := json.Unmarshal(val, &data); err != nil {
+				return err
+			}
+			if data.GTID == "" {
+				return nil
+			}
+			set, err = mysql.ParseGTIDSet(data.Flavor, data.GTID)
+			return err
+		})
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
+	}
 	return
 }
@@ -0,0 +1,22 @@
+package binlog
+
+import (
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+func TestEmptyPositionIsNotSaved(t *testing.T) {
+	posHandler := &memPosHandler{saved: []mysql.Position{{Name: "mysql-bin.000001", Pos: 100}}}
+	b, err := NewBinlogLister(&Config{PosHandler: posHandler, ErrorHandler: func(error) {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// canal reports an empty position when it is closed before it streamed
+	if err = b.OnPosSynced(nil, mysql.Position{}, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	if len(posHandler.saved) != 1 {
+		t.Fatalf("stored position was overwritten by %v", posHandler.saved[1:])
+	}
+}
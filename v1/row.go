@@ -0,0 +1,94 @@
+package binlog
+
+import (
+	"errors"
+
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+// RowHandler receives rows without a Go schema, DbName and TableName are
+// matched like in RegisterEventHandler.
+type RowHandler interface {
+	DbName() string
+	TableName() string
+	OnUpdate(datas ...RowChange)
+	OnDelete(datas ...Row)
+	OnInsert(datas ...Row)
+}
+
+// Row holds the values of one row in the column order of Table.
+type Row struct {
+	Table  *schema.Table
+	Values []any
+}
+
+type RowChange struct {
+	From Row
+	To   Row
+}
+
+// Get returns the value of column, ok is false if the table has no such column.
+func (r Row) Get(column string) (value any, ok bool) {
+	id := r.Table.FindColumn(column)
+	if id < 0 || id >= len(r.Values) {
+		return nil, false
+	}
+	return r.Values[id], true
+}
+
+func (r Row) Map() map[string]any {
+	m := make(map[string]any, len(r.Values))
+	for id, value := range r.Values {
+		if id < len(r.Table.Columns) {
+			m[r.Table.Columns[id].Name] = value
+		}
+	}
+	return m
+}
+
+func (b *BinlogHandler) RegisterRowHandler(h RowHandler) {
+	if b.started() {
+		panic("can not register row handler after Run")
+	}
+	matcher, err := newTableMatcher(h.DbName(), h.TableName())
+	if err != nil {
+		panic(err)
+	}
+	b.rowHandlers = append(b.rowHandlers, &rowSubscription{
+		tableMatcher: matcher,
+		handler:      h,
+	})
+}
+
+func (b *BinlogHandler) dispatchRows(hander RowHandler, e *rowsEvent) error {
+	switch e.Action {
+	case canal.UpdateAction:
+		changes := make([]RowChange, 0, len(e.Rows)/2)
+		for i := 1; i < len(e.Rows); i += 2 {
+			changes = append(changes, RowChange{
+				From: Row{Table: e.Table, Values: e.Rows[i-1]},
+				To:   Row{Table: e.Table, Values: e.Rows[i]},
+			})
+		}
+		if len(changes) > 0 {
+			hander.OnUpdate(changes...)
+		}
+	case canal.InsertAction, canal.DeleteAction:
+		rows := make([]Row, 0, len(e.Rows))
+		for i := range e.Rows {
+			rows = append(rows, Row{Table: e.Table, Values: e.Rows[i]})
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		if e.Action == canal.InsertAction {
+			hander.OnInsert(rows...)
+		} else {
+			hander.OnDelete(rows...)
+		}
+	default:
+		return errors.New("unknown action of onRow")
+	}
+	return nil
+}
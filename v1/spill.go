@@ -0,0 +1,175 @@
+package binlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+// spill holds the tasks which did not fit into the worker queues with
+// SpillWhenFull. Its content is dropped on Run, the position never passes
+// spilled rows, so they are read from the binlog again after a restart.
+type spill struct {
+	db *badger.DB
+
+	mu     sync.Mutex
+	ids    map[*schema.Table]uint32
+	tables []spillTable
+}
+
+// spillTable keeps the table of spilled rows in memory, so that spilled rows
+// are decoded with the schema they were written with.
+type spillTable struct {
+	table    *schema.Table
+	tableKey string
+	handlers *tableHandlers
+}
+
+type spilledTask struct {
+	Table    uint32
+	Action   string
+	Header   *replication.EventHeader
+	Position mysql.Position
+	Rows     [][]any
+}
+
+var gobTypes sync.Map
+
+func openSpill(dir string) (*spill, error) {
+	db, err := badger.Open(badger.DefaultOptions(dir).WithLogger(nil))
+	if err != nil {
+		return nil, err
+	}
+	if err = db.DropAll(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &spill{
+		db:  db,
+		ids: make(map[*schema.Table]uint32, 16),
+	}, nil
+}
+
+func spillKey(worker int, seq uint64) []byte {
+	key := make([]byte, 12)
+	binary.BigEndian.PutUint32(key, uint32(worker))
+	binary.BigEndian.PutUint64(key[4:], seq)
+	return key
+}
+
+func (s *spill) put(q *workerQueue, task *dispatchTask) error {
+	s.mu.Lock()
+	id, ok := s.ids[task.event.Table]
+	if !ok {
+		id = uint32(len(s.tables))
+		s.ids[task.event.Table] = id
+		s.tables = append(s.tables, spillTable{
+			table:    task.event.Table,
+			tableKey: task.event.tableKey,
+			handlers: task.handlers,
+		})
+	}
+	s.mu.Unlock()
+	registerGobTypes(task.event.Rows)
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(spilledTask{
+		Table:    id,
+		Action:   task.event.Action,
+		Header:   task.event.Header,
+		Position: task.event.position,
+		Rows:     task.event.Rows,
+	})
+	if err != nil {
+		return err
+	}
+	err = s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(spillKey(q.id, task.seq), buf.Bytes())
+	})
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&q.spilled, 1)
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// take removes the oldest spilled task of q, the returned task carries its
+// seq even if it could not be decoded.
+func (s *spill) take(q *workerQueue) (*dispatchTask, error) {
+	var key, value []byte
+	err := s.db.Update(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: spillKey(q.id, 0)[:4]})
+		it.Rewind()
+		if !it.Valid() {
+			it.Close()
+			return errors.New("spill is empty")
+		}
+		var err error
+		key = it.Item().KeyCopy(nil)
+		value, err = it.Item().ValueCopy(nil)
+		it.Close()
+		if err != nil {
+			return err
+		}
+		return txn.Delete(key)
+	})
+	atomic.AddInt64(&q.spilled, -1)
+	task := &dispatchTask{}
+	if key != nil {
+		task.seq = binary.BigEndian.Uint64(key[4:])
+	}
+	if err != nil {
+		return task, err
+	}
+	var spilled spilledTask
+	if err = gob.NewDecoder(bytes.NewReader(value)).Decode(&spilled); err != nil {
+		return task, err
+	}
+	s.mu.Lock()
+	table := s.tables[spilled.Table]
+	s.mu.Unlock()
+	task.event = &rowsEvent{
+		RowsEvent: &canal.RowsEvent{
+			Table:  table.table,
+			Action: spilled.Action,
+			Header: spilled.Header,
+			Rows:   spilled.Rows,
+		},
+		tableKey: table.tableKey,
+		position: spilled.Position,
+	}
+	task.handlers = table.handlers
+	return task, nil
+}
+
+func (s *spill) close() error {
+	return s.db.Close()
+}
+
+// registerGobTypes registers the types of the row values, gob needs them to
+// encode values stored in interfaces.
+func registerGobTypes(rows [][]any) {
+	for _, row := range rows {
+		for _, v := range row {
+			if v == nil {
+				continue
+			}
+			if _, ok := gobTypes.LoadOrStore(reflect.TypeOf(v), true); !ok {
+				gob.Register(v)
+			}
+		}
+	}
+}
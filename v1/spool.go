@@ -0,0 +1,495 @@
+package binlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+const (
+	spoolEntryPrefix  = 'e'
+	spoolOffsetPrefix = 'o'
+	spoolNextKey      = 'n'
+	spoolTrimBatch    = 1000
+	// spoolGCInterval is how often the value log GC runs after entries were
+	// dropped.
+	spoolGCInterval = time.Minute
+)
+
+// Spool is a durable log of rows events, set as Config.Spool. Events are
+// appended before the handlers run, so consumers can read them at their own
+// pace, replay them from any offset and resume from a committed offset after a
+// restart. Events are appended before their transaction commits. When Run
+// resumes from the stored position, the events canal delivers again are
+// skipped as long as they match the entries stored after that position, so
+// that every event is stored once and an interrupted transaction is
+// completed. Other start modes and events which do not match, for example
+// after a failover, are appended again. Badger locks dir, consumers in other
+// processes read the spool served by Serve with DialSpool.
+type Spool struct {
+	db      *badger.DB
+	options SpoolOptions
+
+	mu       sync.Mutex
+	first    uint64
+	next     uint64
+	resumed  []spoolEvent
+	size     int64
+	trimmed  time.Time
+	dropped  bool
+	gcErr    error
+	appended chan struct{}
+
+	closeOnce sync.Once
+	stop      chan struct{}
+	collected chan struct{}
+}
+
+// SpoolOptions configures the retention of a Spool. Entries older than MaxAge
+// or beyond MaxSize bytes are dropped whether consumers read them or not, a
+// consumer behind the oldest entry continues with it. Zero values keep entries
+// forever.
+type SpoolOptions struct {
+	MaxAge  time.Duration
+	MaxSize int64
+}
+
+// SpoolEntry is one rows event. Row values are stored as nil, bool, integers,
+// floats, string or []byte, other values like decimal.Decimal as their string
+// representation.
+type SpoolEntry struct {
+	Offset    uint64
+	Time      time.Time
+	Schema    string
+	Table     string
+	Columns   []string
+	PKColumns []int
+	Action    string
+	Position  mysql.Position
+	// GTID is the transaction of the event, empty unless the server runs with
+	// GTIDs.
+	GTID string
+	Rows [][]any
+}
+
+// spoolEvent identifies a rows event delivered again after a restart.
+type spoolEvent struct {
+	position mysql.Position
+	gtid     string
+	table    string
+	action   string
+}
+
+func (e *SpoolEntry) event() spoolEvent {
+	return spoolEvent{
+		position: e.Position,
+		gtid:     e.GTID,
+		table:    e.Schema + "." + e.Table,
+		action:   e.Action,
+	}
+}
+
+func OpenSpool(dir string, options SpoolOptions) (*Spool, error) {
+	db, err := badger.Open(badger.DefaultOptions(dir).WithLogger(nil))
+	if err != nil {
+		return nil, err
+	}
+	s := &Spool{
+		db:        db,
+		options:   options,
+		appended:  make(chan struct{}),
+		stop:      make(chan struct{}),
+		collected: make(chan struct{}),
+	}
+	err = db.View(func(txn *badger.Txn) error {
+		// the next offset is stored on its own, so that offsets are not used
+		// again when the retention dropped every entry
+		item, err := txn.Get([]byte{spoolNextKey})
+		if err == nil {
+			err = item.Value(func(value []byte) error {
+				s.next = binary.BigEndian.Uint64(value)
+				return nil
+			})
+		}
+		if err != nil && !errors.Is(err, badger.ErrKeyNotFound) {
+			return err
+		}
+		s.first = s.next
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: []byte{spoolEntryPrefix}})
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			offset := binary.BigEndian.Uint64(it.Item().Key()[1:])
+			if s.size == 0 {
+				s.first = offset
+			}
+			if offset >= s.next {
+				s.next = offset + 1
+			}
+			s.size += it.Item().ValueSize()
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	go s.collect()
+	return s, nil
+}
+
+func spoolEntryKey(offset uint64) []byte {
+	key := make([]byte, 9)
+	key[0] = spoolEntryPrefix
+	binary.BigEndian.PutUint64(key[1:], offset)
+	return key
+}
+
+func spoolOffsetKey(consumer string) []byte {
+	return append([]byte{spoolOffsetPrefix}, consumer...)
+}
+
+// resume makes append skip the entries stored after from, which canal
+// delivers again when Run resumes from it. An empty from appends every event.
+func (s *Spool) resume(from mysql.Position) error {
+	var resumed []spoolEvent
+	if from.Name != "" {
+		err := s.db.View(func(txn *badger.Txn) error {
+			it := txn.NewIterator(badger.IteratorOptions{
+				Prefix:  []byte{spoolEntryPrefix},
+				Reverse: true,
+			})
+			defer it.Close()
+			for it.Seek(spoolEntryKey(math.MaxUint64)); it.Valid(); it.Next() {
+				var entry SpoolEntry
+				err := it.Item().Value(func(value []byte) error {
+					return gob.NewDecoder(bytes.NewReader(value[8:])).Decode(&entry)
+				})
+				if err != nil {
+					return err
+				}
+				if entry.Position.Compare(from) <= 0 {
+					break
+				}
+				resumed = append(resumed, entry.event())
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for i, j := 0, len(resumed)-1; i < j; i, j = i+1, j-1 {
+			resumed[i], resumed[j] = resumed[j], resumed[i]
+		}
+	}
+	s.mu.Lock()
+	s.resumed = resumed
+	s.mu.Unlock()
+	return nil
+}
+
+// append stores e unless it is the next entry canal delivers again after
+// resume, the first event which is not stops skipping.
+func (s *Spool) append(e *rowsEvent) error {
+	entry := SpoolEntry{
+		Time:      time.Now(),
+		Schema:    e.Table.Schema,
+		Table:     e.Table.Name,
+		Columns:   make([]string, 0, len(e.Table.Columns)),
+		PKColumns: e.Table.PKColumns,
+		Action:    e.Action,
+		Position:  e.position,
+		GTID:      e.gtid,
+		Rows:      make([][]any, 0, len(e.Rows)),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.resumed) > 0 {
+		if s.resumed[0] == entry.event() {
+			s.resumed = s.resumed[1:]
+			return nil
+		}
+		s.resumed = nil
+	}
+	for _, column := range e.Table.Columns {
+		entry.Columns = append(entry.Columns, column.Name)
+	}
+	for _, row := range e.Rows {
+		entry.Rows = append(entry.Rows, spoolRow(row))
+	}
+
+	entry.Offset = s.next
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, entry.Time.UnixNano())
+	if err := gob.NewEncoder(&buf).Encode(&entry); err != nil {
+		return err
+	}
+	next := make([]byte, 8)
+	binary.BigEndian.PutUint64(next, entry.Offset+1)
+	err := s.db.Update(func(txn *badger.Txn) error {
+		if err := txn.Set(spoolEntryKey(entry.Offset), buf.Bytes()); err != nil {
+			return err
+		}
+		return txn.Set([]byte{spoolNextKey}, next)
+	})
+	if err != nil {
+		return err
+	}
+	s.next++
+	s.size += int64(buf.Len())
+	close(s.appended)
+	s.appended = make(chan struct{})
+	return s.trim()
+}
+
+func spoolRow(row []any) []any {
+	values := make([]any, len(row))
+	for i, v := range row {
+		switch v.(type) {
+		case nil, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64,
+			float32, float64, string, []byte:
+			values[i] = v
+		default:
+			values[i] = fmt.Sprint(v)
+		}
+	}
+	return values
+}
+
+// trim applies the retention, the age of the oldest entry is checked at most
+// once a second. s.mu must be held.
+func (s *Spool) trim() error {
+	now := time.Now()
+	byAge := s.options.MaxAge > 0 && now.Sub(s.trimmed) >= time.Second
+	bySize := s.options.MaxSize > 0 && s.size > s.options.MaxSize
+	if !byAge && !bySize {
+		return nil
+	}
+	if byAge {
+		s.trimmed = now
+	}
+	var keys [][]byte
+	size := s.size
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: []byte{spoolEntryPrefix}})
+		defer it.Close()
+		for it.Rewind(); it.Valid() && len(keys) < spoolTrimBatch; it.Next() {
+			item := it.Item()
+			expired := false
+			if s.options.MaxAge > 0 {
+				err := item.Value(func(value []byte) error {
+					at := time.Unix(0, int64(binary.BigEndian.Uint64(value)))
+					expired = now.Sub(at) > s.options.MaxAge
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+			if !expired && (s.options.MaxSize <= 0 || size <= s.options.MaxSize) {
+				break
+			}
+			keys = append(keys, item.KeyCopy(nil))
+			size -= item.ValueSize()
+		}
+		return nil
+	})
+	if err != nil || len(keys) == 0 {
+		return err
+	}
+	err = s.db.Update(func(txn *badger.Txn) error {
+		for _, key := range keys {
+			if err := txn.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.size = size
+	s.first = binary.BigEndian.Uint64(keys[len(keys)-1][1:]) + 1
+	s.dropped = true
+	return nil
+}
+
+// collect runs the value log GC in the background once entries were dropped,
+// so that appends do not wait for it.
+func (s *Spool) collect() {
+	defer close(s.collected)
+	ticker := time.NewTicker(spoolGCInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+		s.mu.Lock()
+		dropped := s.dropped
+		s.dropped = false
+		s.mu.Unlock()
+		if !dropped {
+			continue
+		}
+		if err := s.db.RunValueLogGC(0.5); err != nil && !errors.Is(err, badger.ErrNoRewrite) {
+			s.mu.Lock()
+			s.gcErr = err
+			s.mu.Unlock()
+		}
+	}
+}
+
+// Bounds returns the offset of the oldest entry and the offset the next entry
+// will get, they are equal when the spool is empty.
+func (s *Spool) Bounds() (first uint64, next uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.first, s.next
+}
+
+// Read returns up to limit entries starting at offset from, or at the oldest
+// entry if from was dropped. A limit of zero or less returns every entry.
+func (s *Spool) Read(from uint64, limit int) ([]*SpoolEntry, error) {
+	var entries []*SpoolEntry
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{
+			Prefix:         []byte{spoolEntryPrefix},
+			PrefetchValues: true,
+			PrefetchSize:   100,
+		})
+		defer it.Close()
+		for it.Seek(spoolEntryKey(from)); it.Valid() && (limit <= 0 || len(entries) < limit); it.Next() {
+			entry := &SpoolEntry{}
+			err := it.Item().Value(func(value []byte) error {
+				return gob.NewDecoder(bytes.NewReader(value[8:])).Decode(entry)
+			})
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// Offset returns the next offset consumer reads, which is the oldest entry if
+// consumer has not committed an offset yet or fell behind the retention.
+func (s *Spool) Offset(consumer string) (uint64, error) {
+	var offset uint64
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(spoolOffsetKey(consumer))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(value []byte) error {
+			offset = binary.BigEndian.Uint64(value)
+			return nil
+		})
+	})
+	if err != nil && !errors.Is(err, badger.ErrKeyNotFound) {
+		return 0, err
+	}
+	if first, _ := s.Bounds(); offset < first {
+		offset = first
+	}
+	return offset, nil
+}
+
+// Commit stores the next offset consumer reads, committing an older offset
+// replays the entries from there.
+func (s *Spool) Commit(consumer string, offset uint64) error {
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, offset)
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(spoolOffsetKey(consumer), value)
+	})
+}
+
+// Consume hands the entries from the offset of consumer to handle and commits
+// the offset after each of them. It waits for new entries until ctx is done
+// or handle fails, the failed entry is handed again by the next Consume.
+func (s *Spool) Consume(ctx context.Context, consumer string, handle func(entry *SpoolEntry) error) error {
+	return consumeSpool(ctx, s, consumer, handle)
+}
+
+// wait returns once the spool has an entry at or after offset or ctx is done.
+func (s *Spool) wait(ctx context.Context, offset uint64) error {
+	for {
+		s.mu.Lock()
+		ready := s.first < s.next && s.next > offset
+		appended := s.appended
+		s.mu.Unlock()
+		if ready {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-appended:
+		}
+	}
+}
+
+// Close closes the spool, it returns the last error of the value log GC if
+// closing succeeded.
+func (s *Spool) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		<-s.collected
+		if err = s.db.Close(); err == nil {
+			s.mu.Lock()
+			err = s.gcErr
+			s.mu.Unlock()
+		}
+	})
+	return err
+}
+
+// spoolReader is a Spool or a SpoolClient.
+type spoolReader interface {
+	Read(from uint64, limit int) ([]*SpoolEntry, error)
+	Offset(consumer string) (uint64, error)
+	Commit(consumer string, offset uint64) error
+	wait(ctx context.Context, offset uint64) error
+}
+
+func consumeSpool(ctx context.Context, r spoolReader, consumer string, handle func(entry *SpoolEntry) error) error {
+	offset, err := r.Offset(consumer)
+	if err != nil {
+		return err
+	}
+	for {
+		entries, err := r.Read(offset, 128)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err = handle(entry); err != nil {
+				return err
+			}
+			offset = entry.Offset + 1
+			if err = r.Commit(consumer, offset); err != nil {
+				return err
+			}
+		}
+		if len(entries) > 0 {
+			continue
+		}
+		if err = r.wait(ctx, offset); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package binlog
+
+import (
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+func newSpoolEvent(pos uint32, gtid string) *rowsEvent {
+	return &rowsEvent{
+		RowsEvent: &canal.RowsEvent{
+			Table:  &schema.Table{Schema: "test", Name: "users", Columns: []schema.TableColumn{{Name: "id"}}},
+			Action: canal.InsertAction,
+			Rows:   [][]any{{int64(pos)}},
+		},
+		tableKey: "test.users",
+		position: mysql.Position{Name: "mysql-bin.000001", Pos: pos},
+		gtid:     gtid,
+	}
+}
+
+func appendSpoolEvents(t *testing.T, s *Spool, gtid string, positions ...uint32) {
+	t.Helper()
+	for _, pos := range positions {
+		if err := s.append(newSpoolEvent(pos, gtid)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func checkSpoolPositions(t *testing.T, s *Spool, want ...uint32) {
+	t.Helper()
+	entries, err := s.Read(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("spool has %d entries, want %d", len(entries), len(want))
+	}
+	for i, entry := range entries {
+		if entry.Offset != uint64(i) || entry.Position.Pos != want[i] {
+			t.Fatalf("entry %d is offset %d at %v, want position %d", i, entry.Offset, entry.Position, want[i])
+		}
+	}
+}
+
+func TestSpoolSkipsRedeliveredEvents(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenSpool(dir, SpoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the transaction of 100 and 200 was interrupted before its XID
+	appendSpoolEvents(t, s, "a:1", 100, 200)
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = OpenSpool(dir, SpoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	// canal delivers the transaction again after resuming from 50
+	if err = s.resume(mysql.Position{Name: "mysql-bin.000001", Pos: 50}); err != nil {
+		t.Fatal(err)
+	}
+	appendSpoolEvents(t, s, "a:1", 100, 200, 300)
+	checkSpoolPositions(t, s, 100, 200, 300)
+}
+
+func TestSpoolStoresEventsAgain(t *testing.T) {
+	s, err := OpenSpool(t.TempDir(), SpoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	appendSpoolEvents(t, s, "a:1", 100, 200, 300)
+
+	// started at an earlier position
+	if err = s.resume(mysql.Position{}); err != nil {
+		t.Fatal(err)
+	}
+	appendSpoolEvents(t, s, "a:1", 100, 200)
+	checkSpoolPositions(t, s, 100, 200, 300, 100, 200)
+
+	// resumed on another server whose binlog has other transactions at the
+	// same positions
+	if err = s.resume(mysql.Position{Name: "mysql-bin.000001", Pos: 150}); err != nil {
+		t.Fatal(err)
+	}
+	appendSpoolEvents(t, s, "b:1", 200, 300)
+	checkSpoolPositions(t, s, 100, 200, 300, 100, 200, 200, 300)
+}
+
+func TestSpoolKeepsOffsetsWhenEmpty(t *testing.T) {
+	dir := t.TempDir()
+	// every entry is larger than MaxSize and dropped right away
+	s, err := OpenSpool(dir, SpoolOptions{MaxSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendSpoolEvents(t, s, "", 100, 200, 300)
+	if err = s.Commit("indexer", 3); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = OpenSpool(dir, SpoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if first, next := s.Bounds(); first != 3 || next != 3 {
+		t.Fatalf("bounds are %d, %d after reopening, want 3, 3", first, next)
+	}
+	appendSpoolEvents(t, s, "", 400)
+	offset, err := s.Offset("indexer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := s.Read(offset, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Offset != 3 || entries[0].Position.Pos != 400 {
+		t.Fatalf("consumer at offset %d read %d entries, want the entry at 400", offset, len(entries))
+	}
+}
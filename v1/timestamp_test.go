@@ -0,0 +1,106 @@
+package binlog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+func binlogEvent(timestamp uint32, logPos uint32, event replication.Event) *replication.BinlogEvent {
+	return &replication.BinlogEvent{
+		Header: &replication.EventHeader{Timestamp: timestamp, LogPos: logPos},
+		Event:  event,
+	}
+}
+
+func TestFileScan(t *testing.T) {
+	begin := &replication.QueryEvent{Query: []byte("BEGIN")}
+	start := []*replication.BinlogEvent{
+		binlogEvent(0, 0, &replication.RotateEvent{}),
+		binlogEvent(100, 120, &replication.FormatDescriptionEvent{}),
+	}
+	tests := []struct {
+		name   string
+		size   int64
+		events []*replication.BinlogEvent
+		pos    uint32
+		found  bool
+		// scanned is the number of events handed to the scan
+		scanned int
+	}{
+		{
+			name: "event at t after transactions",
+			size: 10000,
+			events: []*replication.BinlogEvent{
+				binlogEvent(101, 200, begin),
+				binlogEvent(101, 300, &replication.RowsEvent{}),
+				binlogEvent(101, 330, &replication.XIDEvent{}),
+				binlogEvent(102, 400, begin),
+				binlogEvent(102, 500, &replication.RowsEvent{}),
+				binlogEvent(110, 530, &replication.XIDEvent{}),
+			},
+			pos:     330,
+			found:   true,
+			scanned: 8,
+		},
+		{
+			name: "statement and compressed transactions",
+			size: 10000,
+			events: []*replication.BinlogEvent{
+				binlogEvent(101, 200, &replication.QueryEvent{Query: []byte("CREATE TABLE t (id INT)")}),
+				binlogEvent(102, 400, &replication.TransactionPayloadEvent{}),
+				binlogEvent(110, 500, begin),
+			},
+			pos:     400,
+			found:   true,
+			scanned: 5,
+		},
+		{
+			name: "file ends before t",
+			size: 530,
+			events: []*replication.BinlogEvent{
+				binlogEvent(101, 200, begin),
+				binlogEvent(101, 300, &replication.RowsEvent{}),
+				binlogEvent(101, 330, &replication.XIDEvent{}),
+				binlogEvent(102, 400, begin),
+				binlogEvent(102, 530, &replication.RowsEvent{}),
+			},
+			pos:     330,
+			scanned: 7,
+		},
+		{
+			name: "rotate ends the file",
+			size: 10000,
+			events: []*replication.BinlogEvent{
+				binlogEvent(101, 330, &replication.XIDEvent{}),
+				binlogEvent(101, 380, &replication.RotateEvent{}),
+				binlogEvent(110, 400, begin),
+			},
+			pos:     330,
+			scanned: 4,
+		},
+	}
+	at := time.Unix(110, 0)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := binlogFile{name: "mysql-bin.000001", size: tt.size}
+			scan := &fileScan{file: file, t: at, pos: mysql.Position{Name: file.name, Pos: 4}}
+			scanned := 0
+			for _, e := range append(append([]*replication.BinlogEvent{}, start...), tt.events...) {
+				scanned++
+				if scan.next(e) {
+					break
+				}
+			}
+			if scanned != tt.scanned {
+				t.Errorf("scan stopped after %d events, want %d", scanned, tt.scanned)
+			}
+			want := mysql.Position{Name: file.name, Pos: tt.pos}
+			if scan.pos != want || scan.found != tt.found {
+				t.Errorf("scan ended at %v found %v, want %v found %v", scan.pos, scan.found, want, tt.found)
+			}
+		})
+	}
+}
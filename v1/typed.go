@@ -0,0 +1,77 @@
+package binlog
+
+import (
+	"fmt"
+	"reflect"
+)
+
+type Change[T any] struct {
+	Before T
+	After  T
+}
+
+// TypedHandler receives decoded rows as T instead of any, T must be a struct
+// tagged the same way as EventHandler.Schema.
+type TypedHandler[T any] interface {
+	OnUpdate(datas []Change[T])
+	OnDelete(datas []T)
+	OnInsert(datas []T)
+}
+
+type typedEventHandler[T any] struct {
+	dbName    string
+	tableName string
+	handler   TypedHandler[T]
+}
+
+func (t *typedEventHandler[T]) DbName() string {
+	return t.dbName
+}
+
+func (t *typedEventHandler[T]) TableName() string {
+	return t.tableName
+}
+
+func (t *typedEventHandler[T]) Schema() any {
+	return new(T)
+}
+
+func (t *typedEventHandler[T]) OnUpdate(datas ...UpdateHandler) {
+	changes := make([]Change[T], 0, len(datas))
+	for i := range datas {
+		changes = append(changes, Change[T]{
+			Before: *(datas[i].From.(*T)),
+			After:  *(datas[i].To.(*T)),
+		})
+	}
+	t.handler.OnUpdate(changes)
+}
+
+func (t *typedEventHandler[T]) OnDelete(datas ...any) {
+	t.handler.OnDelete(typedRows[T](datas))
+}
+
+func (t *typedEventHandler[T]) OnInsert(datas ...any) {
+	t.handler.OnInsert(typedRows[T](datas))
+}
+
+func typedRows[T any](datas []any) []T {
+	rows := make([]T, 0, len(datas))
+	for i := range datas {
+		rows = append(rows, *(datas[i].(*T)))
+	}
+	return rows
+}
+
+// Register subscribes handler to db.table, rows are decoded into T directly.
+func Register[T any](lister *BinlogHandler, db, table string, handler TypedHandler[T]) {
+	kind := reflect.TypeOf((*T)(nil)).Elem().Kind()
+	if kind != reflect.Struct {
+		panic(fmt.Errorf("expected struct, got %s", kind.String()))
+	}
+	lister.RegisterEventHandler(&typedEventHandler[T]{
+		dbName:    db,
+		tableName: table,
+		handler:   handler,
+	})
+}
@@ -0,0 +1,30 @@
+package binlog
+
+import (
+	"reflect"
+
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+// BinlogScanner is implemented by field types which decode the raw column
+// value themselves, v is the value delivered by canal and may be nil.
+type BinlogScanner interface {
+	ScanBinlog(col *schema.TableColumn, v any) error
+}
+
+// DecodeFunc decodes the raw column value v into the addressable dst, it is
+// registered per Go type in Config.Decoders.
+type DecodeFunc func(col *schema.TableColumn, v any, dst reflect.Value) error
+
+var binlogScannerType = reflect.TypeOf((*BinlogScanner)(nil)).Elem()
+
+func decoderSetter(decode DecodeFunc) fieldSetter {
+	return func(m *BinlogParser, field reflect.Value, e *canal.RowsEvent, n int, columnId int) error {
+		return decode(&e.Table.Columns[columnId], e.Rows[n][columnId], field)
+	}
+}
+
+func setBinlogScanner(m *BinlogParser, field reflect.Value, e *canal.RowsEvent, n int, columnId int) error {
+	return field.Addr().Interface().(BinlogScanner).ScanBinlog(&e.Table.Columns[columnId], e.Rows[n][columnId])
+}
@@ -0,0 +1,374 @@
+package binlog
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// dispatcher runs the handlers of Config.Workers on a worker pool. Every task
+// gets a sequence number and synced positions are held back as checkpoints
+// until all tasks issued before them completed.
+type dispatcher struct {
+	b      *BinlogHandler
+	queues []*workerQueue
+	spill  *spill
+	wg     sync.WaitGroup
+	failed chan struct{}
+	// progress is closed and replaced whenever a worker handled a task
+	progress chan struct{}
+
+	mu          sync.Mutex
+	next        uint64
+	low         uint64
+	completed   map[uint64]bool
+	checkpoints []checkpoint
+	err         error
+	failedSeq   uint64
+}
+
+// QueueStats is a snapshot of the worker queues. Pending counts the rows
+// events handed to the workers and not handled yet, Queued and Spilled those
+// waiting in memory and in the spill. Capacity is the total QueueSize.
+type QueueStats struct {
+	Pending  uint64
+	Queued   int
+	Spilled  int
+	Capacity int
+}
+
+// workerQueue holds the tasks of one worker, in memory up to Config.QueueSize
+// and in the spill beyond. Spilled tasks are always newer than the tasks in
+// memory, new tasks are spilled until the worker caught up with the spill.
+type workerQueue struct {
+	id      int
+	spilled int64
+	tasks   chan *dispatchTask
+	notify  chan struct{}
+	// issued and handled count the tasks of the queue, they are guarded by
+	// the mu of the dispatcher.
+	issued  uint64
+	handled uint64
+}
+
+type dispatchTask struct {
+	seq      uint64
+	event    *rowsEvent
+	handlers *tableHandlers
+}
+
+// checkpoint can be persisted once every task below seq completed.
+type checkpoint struct {
+	seq uint64
+	pos mysql.Position
+	set mysql.GTIDSet
+}
+
+func newDispatcher(b *BinlogHandler, workers int, size int, spill *spill) *dispatcher {
+	d := &dispatcher{
+		b:         b,
+		queues:    make([]*workerQueue, workers),
+		spill:     spill,
+		failed:    make(chan struct{}),
+		progress:  make(chan struct{}),
+		completed: make(map[uint64]bool, workers*size),
+	}
+	for i := range d.queues {
+		d.queues[i] = &workerQueue{
+			id:     i,
+			tasks:  make(chan *dispatchTask, size),
+			notify: make(chan struct{}, 1),
+		}
+		d.wg.Add(1)
+		go d.work(d.queues[i])
+	}
+	return d
+}
+
+// dispatch groups the rows by worker and queues them, the before and after
+// image of an update stay together. A full queue blocks unless the dispatcher
+// spills, a failure of an earlier task is returned to stop canal.
+//
+// An update whose primary key changes to a key of another worker runs on the
+// worker of the old key once both workers handled their earlier rows, and
+// later rows are only queued after it was handled. That keeps the changes of
+// both keys in order.
+func (d *dispatcher) dispatch(e *rowsEvent, handlers *tableHandlers) error {
+	if err := d.failure(); err != nil {
+		return err
+	}
+	step := 1
+	if e.Action == canal.UpdateAction {
+		step = 2
+	}
+	groups := make([][][]any, len(d.queues))
+	for i := 0; i+step <= len(e.Rows); i += step {
+		rows := e.Rows[i : i+step]
+		worker := d.workerOf(e, rows[0])
+		if step == 2 {
+			if moved := d.workerOf(e, rows[1]); moved != worker {
+				if err := d.queue(e, handlers, groups); err != nil {
+					return err
+				}
+				groups = make([][][]any, len(d.queues))
+				from, to := d.queues[worker], d.queues[moved]
+				if err := d.drain(from, to); err != nil {
+					return err
+				}
+				if err := d.issue(from, e, handlers, rows); err != nil {
+					return err
+				}
+				if err := d.drain(from); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		groups[worker] = append(groups[worker], rows...)
+	}
+	return d.queue(e, handlers, groups)
+}
+
+// queue issues the rows of every worker as one task.
+func (d *dispatcher) queue(e *rowsEvent, handlers *tableHandlers, groups [][][]any) error {
+	for i, rows := range groups {
+		if len(rows) == 0 {
+			continue
+		}
+		if err := d.issue(d.queues[i], e, handlers, rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *dispatcher) issue(q *workerQueue, e *rowsEvent, handlers *tableHandlers, rows [][]any) error {
+	event := *e.RowsEvent
+	event.Rows = rows
+	task := &dispatchTask{
+		event:    &rowsEvent{RowsEvent: &event, tableKey: e.tableKey, position: e.position, gtid: e.gtid},
+		handlers: handlers,
+	}
+	d.mu.Lock()
+	task.seq = d.next
+	d.next++
+	q.issued++
+	d.mu.Unlock()
+	return d.push(q, task)
+}
+
+// drain waits until the workers of queues handled every task issued to them.
+func (d *dispatcher) drain(queues ...*workerQueue) error {
+	for {
+		d.mu.Lock()
+		drained := true
+		for _, q := range queues {
+			drained = drained && q.handled == q.issued
+		}
+		progress := d.progress
+		d.mu.Unlock()
+		if drained {
+			return nil
+		}
+		select {
+		case <-progress:
+		case <-d.failed:
+			return d.failure()
+		case <-d.b.ctx.Done():
+			return d.b.ctx.Err()
+		}
+	}
+}
+
+func (d *dispatcher) push(q *workerQueue, task *dispatchTask) error {
+	if d.spill != nil {
+		if atomic.LoadInt64(&q.spilled) == 0 {
+			select {
+			case q.tasks <- task:
+				return nil
+			default:
+			}
+		}
+		return d.spill.put(q, task)
+	}
+	select {
+	case q.tasks <- task:
+		return nil
+	case <-d.b.ctx.Done():
+		return d.b.ctx.Err()
+	}
+}
+
+// pop returns the next task of q, ok is false once q is closed and empty.
+func (d *dispatcher) pop(q *workerQueue) (task *dispatchTask, ok bool) {
+	closed := false
+	for {
+		if !closed {
+			select {
+			case task, ok = <-q.tasks:
+				if ok {
+					return task, true
+				}
+				closed = true
+			default:
+			}
+		}
+		if d.spill != nil && atomic.LoadInt64(&q.spilled) > 0 {
+			task, err := d.spill.take(q)
+			if err != nil {
+				d.fail(task.seq, err)
+				d.handled(q)
+				continue
+			}
+			return task, true
+		}
+		if closed {
+			return nil, false
+		}
+		select {
+		case task, ok = <-q.tasks:
+			if ok {
+				return task, true
+			}
+			closed = true
+		case <-q.notify:
+		}
+	}
+}
+
+func (d *dispatcher) workerOf(e *rowsEvent, row []any) int {
+	h := fnv.New32a()
+	h.Write([]byte(e.tableKey))
+	for _, id := range e.Table.PKColumns {
+		if id < len(row) {
+			fmt.Fprintf(h, "\x00%v", row[id])
+		}
+	}
+	return int(h.Sum32() % uint32(len(d.queues)))
+}
+
+// work runs the tasks of one queue. Tasks issued after a failed task are
+// skipped, earlier ones still run so that the position reaches the failed
+// rows.
+func (d *dispatcher) work(q *workerQueue) {
+	defer d.wg.Done()
+	for {
+		task, ok := d.pop(q)
+		if !ok {
+			return
+		}
+		if d.skip(task.seq) {
+			d.handled(q)
+			continue
+		}
+		if err := d.b.handleRows(task.event, task.handlers); err != nil {
+			d.fail(task.seq, err)
+			d.handled(q)
+			continue
+		}
+		d.complete(task.seq)
+		d.handled(q)
+	}
+}
+
+// handled counts a task of q whatever its outcome.
+func (d *dispatcher) handled(q *workerQueue) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	q.handled++
+	close(d.progress)
+	d.progress = make(chan struct{})
+}
+
+func (d *dispatcher) complete(seq uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.completed[seq] = true
+	for d.completed[d.low] {
+		delete(d.completed, d.low)
+		d.low++
+	}
+	_ = d.flush()
+}
+
+func (d *dispatcher) checkpoint(pos mysql.Position, set mysql.GTIDSet) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if n := len(d.checkpoints); n > 0 && d.checkpoints[n-1].seq == d.next {
+		d.checkpoints = d.checkpoints[:n-1]
+	}
+	d.checkpoints = append(d.checkpoints, checkpoint{seq: d.next, pos: pos, set: set})
+	return d.flush()
+}
+
+// flush persists the newest checkpoint whose tasks all completed, d.mu must
+// be held.
+func (d *dispatcher) flush() error {
+	ready := -1
+	for i, cp := range d.checkpoints {
+		if cp.seq > d.low {
+			break
+		}
+		ready = i
+	}
+	if ready < 0 {
+		return nil
+	}
+	cp := d.checkpoints[ready]
+	d.checkpoints = d.checkpoints[ready+1:]
+	return d.b.savePosition(cp.pos, cp.set)
+}
+
+func (d *dispatcher) fail(seq uint64, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err == nil {
+		d.err = err
+		d.failedSeq = seq
+		close(d.failed)
+	} else if seq < d.failedSeq {
+		d.failedSeq = seq
+	}
+}
+
+func (d *dispatcher) skip(seq uint64) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err != nil && seq > d.failedSeq
+}
+
+func (d *dispatcher) failure() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err
+}
+
+func (d *dispatcher) stats() QueueStats {
+	var stats QueueStats
+	for _, q := range d.queues {
+		stats.Queued += len(q.tasks)
+		stats.Spilled += int(atomic.LoadInt64(&q.spilled))
+		stats.Capacity += cap(q.tasks)
+	}
+	d.mu.Lock()
+	stats.Pending = d.next - d.low
+	d.mu.Unlock()
+	return stats
+}
+
+// close waits until the workers handled or skipped every queued and spilled
+// task, canal must be stopped.
+func (d *dispatcher) close() error {
+	for _, q := range d.queues {
+		close(q.tasks)
+	}
+	d.wg.Wait()
+	if d.spill != nil {
+		return d.spill.close()
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package binlog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+type memPosHandler struct {
+	saved []mysql.Position
+}
+
+func (h *memPosHandler) UpdatePos(pos mysql.Position) error {
+	h.saved = append(h.saved, pos)
+	return nil
+}
+
+func (h *memPosHandler) GetLatestPos() (mysql.Position, error) {
+	if len(h.saved) == 0 {
+		return mysql.Position{}, nil
+	}
+	return h.saved[len(h.saved)-1], nil
+}
+
+// newTestDispatcher returns a dispatcher without workers, tasks are issued and
+// completed by the test.
+func newTestDispatcher(t *testing.T) (*dispatcher, *memPosHandler) {
+	posHandler := &memPosHandler{}
+	b, err := NewBinlogLister(&Config{PosHandler: posHandler, ErrorHandler: func(error) {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &dispatcher{
+		b:         b,
+		failed:    make(chan struct{}),
+		progress:  make(chan struct{}),
+		completed: make(map[uint64]bool),
+	}
+	return d, posHandler
+}
+
+func (d *dispatcher) reserve(n int) {
+	d.mu.Lock()
+	d.next += uint64(n)
+	d.mu.Unlock()
+}
+
+func TestDispatcherHoldsCheckpointUntilEarlierTasksComplete(t *testing.T) {
+	d, posHandler := newTestDispatcher(t)
+	first := mysql.Position{Name: "mysql-bin.000001", Pos: 100}
+	second := mysql.Position{Name: "mysql-bin.000001", Pos: 200}
+
+	d.reserve(2)
+	if err := d.checkpoint(first, nil); err != nil {
+		t.Fatal(err)
+	}
+	d.reserve(1)
+	if err := d.checkpoint(second, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	d.complete(1)
+	d.complete(2)
+	if len(posHandler.saved) != 0 {
+		t.Fatalf("saved %v before task 0 completed", posHandler.saved)
+	}
+	d.complete(0)
+	if len(posHandler.saved) != 1 || posHandler.saved[0] != second {
+		t.Fatalf("saved %v, want only %v", posHandler.saved, second)
+	}
+}
+
+func TestDispatcherNeverPassesFailedTask(t *testing.T) {
+	d, posHandler := newTestDispatcher(t)
+	before := mysql.Position{Name: "mysql-bin.000001", Pos: 100}
+	after := mysql.Position{Name: "mysql-bin.000001", Pos: 200}
+
+	d.reserve(1)
+	if err := d.checkpoint(before, nil); err != nil {
+		t.Fatal(err)
+	}
+	d.reserve(3)
+	if err := d.checkpoint(after, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	d.fail(1, errors.New("handler failed"))
+	if d.skip(0) || d.skip(1) {
+		t.Fatal("tasks up to the failed one must run")
+	}
+	for seq := uint64(2); seq < 4; seq++ {
+		if !d.skip(seq) {
+			t.Fatalf("task %d after the failed task was not skipped", seq)
+		}
+	}
+	// a later task which was already running when the failure happened
+	d.complete(3)
+	d.complete(0)
+	if len(posHandler.saved) != 1 || posHandler.saved[0] != before {
+		t.Fatalf("saved %v, want only %v", posHandler.saved, before)
+	}
+	if d.failure() == nil {
+		t.Fatal("failure was not recorded")
+	}
+}
+
+// orderHandler records the rows it handled, each row takes as many
+// milliseconds as its second value.
+type orderHandler struct {
+	mu      sync.Mutex
+	handled []string
+}
+
+func (h *orderHandler) DbName() string    { return "test" }
+func (h *orderHandler) TableName() string { return "users" }
+
+func (h *orderHandler) OnUpdate(header *replication.EventHeader, datas ...RowChange) {
+	for _, change := range datas {
+		h.handle(change.To, fmt.Sprintf("update %v to %v", change.From.Values[0], change.To.Values[0]))
+	}
+}
+
+func (h *orderHandler) OnDelete(header *replication.EventHeader, datas ...Row) {
+	for _, row := range datas {
+		h.handle(row, fmt.Sprintf("delete %v", row.Values[0]))
+	}
+}
+
+func (h *orderHandler) OnInsert(header *replication.EventHeader, datas ...Row) {
+	for _, row := range datas {
+		h.handle(row, fmt.Sprintf("insert %v", row.Values[0]))
+	}
+}
+
+func (h *orderHandler) handle(row Row, change string) {
+	time.Sleep(time.Duration(row.Values[1].(int64)) * time.Millisecond)
+	h.mu.Lock()
+	h.handled = append(h.handled, change)
+	h.mu.Unlock()
+}
+
+func TestDispatcherKeepsOrderOfMovedRows(t *testing.T) {
+	b, err := NewBinlogLister(&Config{PosHandler: &memPosHandler{}, ErrorHandler: func(error) {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.ctx = context.Background()
+	d := newDispatcher(b, 2, 4, nil)
+	table := &schema.Table{
+		Schema:    "test",
+		Name:      "users",
+		Columns:   []schema.TableColumn{{Name: "id"}, {Name: "delay"}},
+		PKColumns: []int{0},
+	}
+	event := func(action string, rows ...[]any) *rowsEvent {
+		return &rowsEvent{
+			RowsEvent: &canal.RowsEvent{Table: table, Action: action, Rows: rows},
+			tableKey:  "test.users",
+		}
+	}
+	// from and to are handled by different workers
+	from, to := int64(1), int64(2)
+	for d.workerOf(event(canal.InsertAction), []any{to}) == d.workerOf(event(canal.InsertAction), []any{from}) {
+		to++
+	}
+	h := &orderHandler{}
+	handlers := &tableHandlers{rows: []RowHandler{h}}
+
+	events := []*rowsEvent{
+		event(canal.DeleteAction, []any{to, int64(50)}),
+		event(canal.UpdateAction, []any{from, int64(0)}, []any{to, int64(50)}),
+		event(canal.DeleteAction, []any{to, int64(0)}),
+	}
+	for _, e := range events {
+		if err = d.dispatch(e, handlers); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = d.close(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		fmt.Sprintf("delete %d", to),
+		fmt.Sprintf("update %d to %d", from, to),
+		fmt.Sprintf("delete %d", to),
+	}
+	if fmt.Sprint(h.handled) != fmt.Sprint(want) {
+		t.Fatalf("handled %v, want %v", h.handled, want)
+	}
+}
@@ -0,0 +1,26 @@
+package binlog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewBinlogListerRejectsConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{"AtLeastOnce with SkipOnFailure", Config{AtLeastOnce: true, FailurePolicy: SkipOnFailure}},
+		{"AtPosition without StartPosition", Config{StartMode: AtPosition}},
+		{"AtTimestamp without StartTime", Config{StartMode: AtTimestamp}},
+		{"StartTime without AtTimestamp", Config{StartTime: time.Now()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.PosHandler = &memPosHandler{}
+			if _, err := NewBinlogLister(&tt.config); err == nil {
+				t.Fatal("config was accepted")
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package binlog
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// tableMatcher matches the DbName and TableName of a handler. Names starting
+// with ^ are regular expressions, other names may use the * and ? wildcards.
+type tableMatcher struct {
+	key     string
+	exact   bool
+	pattern string
+	re      *regexp.Regexp
+}
+
+func newTableMatcher(db string, table string) (*tableMatcher, error) {
+	dbPattern, dbExact := namePattern(db)
+	tablePattern, tableExact := namePattern(table)
+	pattern := fmt.Sprintf(`^(?:%s)\.(?:%s)$`, dbPattern, tablePattern)
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid table pattern %s.%s: %w", db, table, err)
+	}
+	return &tableMatcher{
+		key:     db + "." + table,
+		exact:   dbExact && tableExact,
+		pattern: pattern,
+		re:      re,
+	}, nil
+}
+
+func namePattern(name string) (pattern string, exact bool) {
+	if strings.HasPrefix(name, "^") {
+		return strings.TrimSuffix(strings.TrimPrefix(name, "^"), "$"), false
+	}
+	pattern = regexp.QuoteMeta(name)
+	pattern = strings.ReplaceAll(pattern, `\*`, `.*`)
+	pattern = strings.ReplaceAll(pattern, `\?`, `.`)
+	return pattern, pattern == regexp.QuoteMeta(name)
+}
+
+func (t *tableMatcher) match(key string) bool {
+	if t.exact {
+		return t.key == key
+	}
+	return t.re.MatchString(key)
+}
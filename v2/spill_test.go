@@ -0,0 +1,65 @@
+package binlog
+
+import (
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+func TestSpillTakesTasksInOrder(t *testing.T) {
+	s, err := openSpill(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	table := &schema.Table{Schema: "test", Name: "users"}
+	queues := []*workerQueue{
+		{id: 0, notify: make(chan struct{}, 1)},
+		{id: 1, notify: make(chan struct{}, 1)},
+	}
+	// 255 and 256 differ in the last byte in the wrong order if the key was
+	// not big endian
+	seqs := []uint64{3, 255, 256, 70000}
+	for i, seq := range seqs {
+		for _, q := range queues {
+			task := &dispatchTask{
+				seq: seq,
+				event: &rowsEvent{
+					RowsEvent: &canal.RowsEvent{
+						Table:  table,
+						Action: canal.InsertAction,
+						Rows:   [][]any{{int64(i), q.id}},
+					},
+					tableKey: "test.users",
+					position: mysql.Position{Name: "mysql-bin.000001", Pos: uint32(seq)},
+				},
+			}
+			if err = s.put(q, task); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for _, q := range queues {
+		for i, seq := range seqs {
+			task, err := s.take(q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if task.seq != seq {
+				t.Fatalf("worker %d: took seq %d, want %d", q.id, task.seq, seq)
+			}
+			if task.event.position.Pos != uint32(seq) || task.event.tableKey != "test.users" {
+				t.Fatalf("worker %d: took %+v with position %v", q.id, task.event.RowsEvent, task.event.position)
+			}
+			if row := task.event.Rows[0]; row[0] != int64(i) || row[1] != q.id {
+				t.Fatalf("worker %d: took row %v of another task", q.id, row)
+			}
+		}
+		if q.spilled != 0 {
+			t.Fatalf("worker %d: %d tasks left in the spill", q.id, q.spilled)
+		}
+	}
+}
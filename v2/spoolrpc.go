@@ -0,0 +1,129 @@
+package binlog
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/rpc"
+	"time"
+)
+
+// spoolWaitTimeout bounds a wait of a SpoolClient for new entries, the client
+// waits again until its context is done.
+const spoolWaitTimeout = 30 * time.Second
+
+// net/rpc only serves exported or unnamed argument types.
+type (
+	spoolReadArgs = struct {
+		From  uint64
+		Limit int
+	}
+	spoolCommitArgs = struct {
+		Consumer string
+		Offset   uint64
+	}
+	spoolWaitArgs = struct {
+		Offset  uint64
+		Timeout time.Duration
+	}
+)
+
+type spoolService struct {
+	s *Spool
+}
+
+func (r *spoolService) Read(args spoolReadArgs, entries *[]*SpoolEntry) error {
+	var err error
+	*entries, err = r.s.Read(args.From, args.Limit)
+	return err
+}
+
+func (r *spoolService) Offset(consumer string, offset *uint64) error {
+	var err error
+	*offset, err = r.s.Offset(consumer)
+	return err
+}
+
+func (r *spoolService) Commit(args spoolCommitArgs, _ *struct{}) error {
+	return r.s.Commit(args.Consumer, args.Offset)
+}
+
+func (r *spoolService) Wait(args spoolWaitArgs, ready *bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), args.Timeout)
+	defer cancel()
+	*ready = r.s.wait(ctx, args.Offset) == nil
+	return nil
+}
+
+// Serve lets consumers in other processes read the spool with DialSpool. It
+// serves the connections accepted by l until l is closed, the lister keeps
+// appending meanwhile.
+func (s *Spool) Serve(l net.Listener) error {
+	server := rpc.NewServer()
+	if err := server.RegisterName("Spool", &spoolService{s: s}); err != nil {
+		return err
+	}
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go server.ServeConn(conn)
+	}
+}
+
+// SpoolClient reads a Spool served by another process, its methods work like
+// the ones of Spool.
+type SpoolClient struct {
+	client *rpc.Client
+}
+
+func DialSpool(network string, address string) (*SpoolClient, error) {
+	client, err := rpc.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &SpoolClient{client: client}, nil
+}
+
+func (c *SpoolClient) Read(from uint64, limit int) ([]*SpoolEntry, error) {
+	var entries []*SpoolEntry
+	err := c.client.Call("Spool.Read", spoolReadArgs{From: from, Limit: limit}, &entries)
+	return entries, err
+}
+
+func (c *SpoolClient) Offset(consumer string) (uint64, error) {
+	var offset uint64
+	err := c.client.Call("Spool.Offset", consumer, &offset)
+	return offset, err
+}
+
+func (c *SpoolClient) Commit(consumer string, offset uint64) error {
+	return c.client.Call("Spool.Commit", spoolCommitArgs{Consumer: consumer, Offset: offset}, &struct{}{})
+}
+
+func (c *SpoolClient) Consume(ctx context.Context, consumer string, handle func(entry *SpoolEntry) error) error {
+	return consumeSpool(ctx, c, consumer, handle)
+}
+
+func (c *SpoolClient) wait(ctx context.Context, offset uint64) error {
+	for {
+		var ready bool
+		call := c.client.Go("Spool.Wait", spoolWaitArgs{Offset: offset, Timeout: spoolWaitTimeout}, &ready, nil)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-call.Done:
+		}
+		if call.Error != nil || ready {
+			return call.Error
+		}
+	}
+}
+
+func (c *SpoolClient) Close() error {
+	return c.client.Close()
+}
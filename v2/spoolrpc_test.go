@@ -0,0 +1,60 @@
+package binlog
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSpoolClientConsumes(t *testing.T) {
+	s, err := OpenSpool(t.TempDir(), SpoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go s.Serve(l)
+
+	client, err := DialSpool("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	appendSpoolEvents(t, s, "", 100, 200)
+	go func() {
+		// appended while the client waits for new entries
+		time.Sleep(50 * time.Millisecond)
+		if err := s.append(newSpoolEvent(300, "")); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var got []uint32
+	err = client.Consume(ctx, "indexer", func(entry *SpoolEntry) error {
+		got = append(got, entry.Position.Pos)
+		if len(got) == 3 {
+			cancel()
+		}
+		return nil
+	})
+	if err != context.Canceled {
+		t.Fatalf("Consume returned %v", err)
+	}
+	if len(got) != 3 || got[0] != 100 || got[1] != 200 || got[2] != 300 {
+		t.Fatalf("consumed %v", got)
+	}
+	offset, err := s.Offset("indexer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != 3 {
+		t.Fatalf("committed offset %d, want 3", offset)
+	}
+}
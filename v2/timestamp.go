@@ -0,0 +1,195 @@
+package binlog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// scanTimeout bounds the wait for the next event while searching a binlog
+// file, the files are complete so events arrive without delay.
+const scanTimeout = 30 * time.Second
+
+type binlogFile struct {
+	name string
+	size int64
+}
+
+func (b *BinlogHandler) binlogFiles() ([]binlogFile, error) {
+	r, err := b.canalCli.Execute("SHOW BINARY LOGS")
+	if err != nil {
+		return nil, err
+	}
+	files := make([]binlogFile, 0, r.RowNumber())
+	for i := 0; i < r.RowNumber(); i++ {
+		name, err := r.GetString(i, 0)
+		if err != nil {
+			return nil, err
+		}
+		size, err := r.GetInt(i, 1)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, binlogFile{name: name, size: size})
+	}
+	return files, nil
+}
+
+// positionAt returns the start of the first transaction with an event at or
+// after t, or the end of the binlog if there is no such event yet. The file
+// is found by a binary search over the timestamps of the first event of each
+// file, which is then scanned from its start.
+func (b *BinlogHandler) positionAt(t time.Time) (mysql.Position, error) {
+	files, err := b.binlogFiles()
+	if err != nil {
+		return mysql.Position{}, err
+	}
+	if len(files) == 0 {
+		return mysql.Position{}, errors.New("binary logging is disabled")
+	}
+	lo, hi := 0, len(files)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		start, err := b.fileStart(files[mid])
+		if err != nil {
+			return mysql.Position{}, err
+		}
+		if start.After(t) {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	if lo > 0 {
+		lo--
+	}
+	var pos mysql.Position
+	for _, file := range files[lo:] {
+		var found bool
+		pos, found, err = b.scanFile(file, t)
+		if err != nil || found {
+			break
+		}
+	}
+	return pos, err
+}
+
+// fileStart returns the timestamp of the format description event which
+// starts every binlog file.
+func (b *BinlogHandler) fileStart(file binlogFile) (time.Time, error) {
+	var start time.Time
+	err := b.scanBinlog(file, func(e *replication.BinlogEvent) bool {
+		if e.Header.Timestamp == 0 {
+			return false
+		}
+		start = time.Unix(int64(e.Header.Timestamp), 0)
+		return true
+	})
+	return start, err
+}
+
+// scanFile looks for the first event at or after t in file, pos is the end of
+// the last transaction before it or before the end of file.
+func (b *BinlogHandler) scanFile(file binlogFile, t time.Time) (pos mysql.Position, found bool, err error) {
+	scan := &fileScan{file: file, t: t, pos: mysql.Position{Name: file.name, Pos: 4}}
+	err = b.scanBinlog(file, scan.next)
+	return scan.pos, scan.found, err
+}
+
+// fileScan tracks the end of the last transaction before t while the events
+// of file are streamed.
+type fileScan struct {
+	file  binlogFile
+	t     time.Time
+	pos   mysql.Position
+	found bool
+}
+
+// next handles one event and returns true once the scan is done.
+func (s *fileScan) next(e *replication.BinlogEvent) bool {
+	if _, ok := e.Event.(*replication.RotateEvent); ok {
+		// the fake rotate event at the start has no position, a real one
+		// ends the file
+		return e.Header.LogPos != 0
+	}
+	if e.Header.Timestamp != 0 && !time.Unix(int64(e.Header.Timestamp), 0).Before(s.t) {
+		s.found = true
+		return true
+	}
+	switch event := e.Event.(type) {
+	case *replication.XIDEvent:
+		s.pos.Pos = e.Header.LogPos
+	case *replication.TransactionPayloadEvent:
+		// a transaction compressed by binlog_transaction_compression
+		s.pos.Pos = e.Header.LogPos
+	case *replication.QueryEvent:
+		if string(event.Query) != "BEGIN" {
+			s.pos.Pos = e.Header.LogPos
+		}
+	}
+	return int64(e.Header.LogPos) >= s.file.size
+}
+
+// scanBinlog streams file from its start without decoding rows until fn
+// returns true.
+func (b *BinlogHandler) scanBinlog(file binlogFile, fn func(e *replication.BinlogEvent) bool) error {
+	cfg, err := b.syncerConfig()
+	if err != nil {
+		return err
+	}
+	syncer := replication.NewBinlogSyncer(cfg)
+	defer syncer.Close()
+	streamer, err := syncer.StartSync(mysql.Position{Name: file.name, Pos: 4})
+	if err != nil {
+		return err
+	}
+	for {
+		ctx, cancel := context.WithTimeout(b.ctx, scanTimeout)
+		e, err := streamer.GetEvent(ctx)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("scan binlog %s: %w", file.name, err)
+		}
+		if fn(e) {
+			return nil
+		}
+	}
+}
+
+func (b *BinlogHandler) syncerConfig() (replication.BinlogSyncerConfig, error) {
+	cfg := replication.BinlogSyncerConfig{
+		ServerID:  b.canalCfg.ServerID,
+		Flavor:    b.canalCfg.Flavor,
+		User:      b.canalCfg.User,
+		Password:  b.canalCfg.Password,
+		Charset:   b.canalCfg.Charset,
+		TLSConfig: b.canalCfg.TLSConfig,
+		Logger:    b.canalCfg.Logger,
+		Dialer:    b.canalCfg.Dialer,
+		RowsEventDecodeFunc: func(event *replication.RowsEvent, data []byte) error {
+			_, err := event.DecodeHeader(data)
+			return err
+		},
+	}
+	if strings.Contains(b.canalCfg.Addr, "/") {
+		cfg.Host = b.canalCfg.Addr
+		return cfg, nil
+	}
+	host, port, ok := strings.Cut(b.canalCfg.Addr, ":")
+	if !ok {
+		return cfg, fmt.Errorf("invalid mysql addr format %s, must host:port", b.canalCfg.Addr)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Host = host
+	cfg.Port = uint16(p)
+	return cfg, nil
+}
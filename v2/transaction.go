@@ -0,0 +1,154 @@
+package binlog
+
+import (
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+// TransactionHandler receives the changes of its tables once per committed
+// transaction instead of once per rows event, DbName and TableName are
+// matched like in RegisterEventHandler. Changes are buffered until the XID
+// event, so only transactional storage engines like InnoDB are supported.
+type TransactionHandler interface {
+	DbName() string
+	TableName() string
+	OnTransaction(tx *Transaction) error
+}
+
+// Transaction holds the changes of one transaction in binlog order.
+type Transaction struct {
+	// GTID is empty unless the server runs with GTIDs.
+	GTID string
+	// Position is the position after the XID event.
+	Position mysql.Position
+	// Timestamp is the commit time in Config.Location, it has microseconds
+	// on MySQL 8.0.1 and later and seconds otherwise.
+	Timestamp time.Time
+	Changes   []TransactionChange
+}
+
+// TransactionChange holds the rows of one rows event, Rows for inserts and
+// deletes and Updates for updates.
+type TransactionChange struct {
+	Table   *schema.Table
+	Action  string
+	Rows    []Row
+	Updates []RowChange
+}
+
+type txSubscription struct {
+	*tableMatcher
+	handler TransactionHandler
+}
+
+// txBuffer collects the changes of the running transaction.
+type txBuffer struct {
+	gtid       string
+	commitTime time.Time
+	changes    []txChange
+}
+
+type txChange struct {
+	TransactionChange
+	tableKey string
+}
+
+func (b *BinlogHandler) RegisterTransactionHandler(h TransactionHandler) {
+	if b.started() {
+		panic("can not register transaction handler after Run")
+	}
+	matcher, err := newTableMatcher(h.DbName(), h.TableName())
+	if err != nil {
+		panic(err)
+	}
+	b.txHandlers = append(b.txHandlers, &txSubscription{
+		tableMatcher: matcher,
+		handler:      h,
+	})
+}
+
+func (b *BinlogHandler) bufferTransaction(e *rowsEvent) {
+	change := txChange{
+		TransactionChange: TransactionChange{
+			Table:  e.Table,
+			Action: e.Action,
+		},
+		tableKey: e.tableKey,
+	}
+	if e.Action == canal.UpdateAction {
+		change.Updates = make([]RowChange, 0, len(e.Rows)/2)
+		for i := 1; i < len(e.Rows); i += 2 {
+			change.Updates = append(change.Updates, RowChange{
+				From: Row{Table: e.Table, Values: e.Rows[i-1]},
+				To:   Row{Table: e.Table, Values: e.Rows[i]},
+			})
+		}
+	} else {
+		change.Rows = make([]Row, 0, len(e.Rows))
+		for i := range e.Rows {
+			change.Rows = append(change.Rows, Row{Table: e.Table, Values: e.Rows[i]})
+		}
+	}
+	b.tx.changes = append(b.tx.changes, change)
+}
+
+// OnGTID records the GTID and commit time of the next transaction, the GTID
+// is also stored with the events in Config.Spool.
+func (b *BinlogHandler) OnGTID(header *replication.EventHeader, gtidEvent mysql.BinlogGTIDEvent) error {
+	if len(b.txHandlers) == 0 && b.config.Spool == nil {
+		return nil
+	}
+	if set, err := gtidEvent.GTIDNext(); err == nil {
+		b.tx.gtid = set.String()
+	}
+	if e, ok := gtidEvent.(*replication.GTIDEvent); ok {
+		b.tx.commitTime = e.ImmediateCommitTime()
+	}
+	return nil
+}
+
+// OnXID hands the buffered changes to every TransactionHandler with at least
+// one subscribed table. Failures are handled like in OnRow, canal syncs the
+// position of the transaction only after OnXID returned.
+func (b *BinlogHandler) OnXID(header *replication.EventHeader, nextPos mysql.Position) error {
+	if len(b.txHandlers) == 0 {
+		return nil
+	}
+	buffer := b.tx
+	b.tx = txBuffer{}
+	if len(buffer.changes) == 0 {
+		return nil
+	}
+	timestamp := buffer.commitTime
+	if timestamp.IsZero() {
+		timestamp = time.Unix(int64(header.Timestamp), 0)
+	}
+	var err error
+	for _, s := range b.txHandlers {
+		tx := &Transaction{
+			GTID:      buffer.gtid,
+			Position:  nextPos,
+			Timestamp: timestamp.In(b.location),
+		}
+		for _, change := range buffer.changes {
+			if s.match(change.tableKey) {
+				tx.Changes = append(tx.Changes, change.TransactionChange)
+			}
+		}
+		if len(tx.Changes) == 0 {
+			continue
+		}
+		hander := s.handler
+		dispatchErr := b.safeDispatch(s.key, "transaction", nextPos, func() error {
+			return hander.OnTransaction(tx)
+		})
+		if dispatchErr != nil && err == nil {
+			err = dispatchErr
+		}
+	}
+	return err
+}